@@ -0,0 +1,130 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+// maxSlabSize is the largest number of elements in a slab. Slabs start
+// small and double in size, so that transactions that only create a few
+// nodes don't pay for a large slab, up to this limit.
+const maxSlabSize = 256
+
+// slab hands out slices of a larger chunk of memory. Each element is handed
+// out once and never reused, and the slices are capped so that appending to
+// one can't overwrite the elements after it, which is what makes the nodes
+// built from a slab safe to share immutably once committed.
+type slab[E any] struct {
+	// free is the part of the current chunk that hasn't been handed out.
+	free []E
+
+	// size is the size of the next chunk.
+	size int
+}
+
+// alloc returns a slice of n zeroed elements.
+func (s *slab[E]) alloc(n int) []E {
+	if len(s.free) < n {
+		if s.size == 0 {
+			s.size = 1
+		}
+		size := s.size
+		if size < n {
+			size = n
+		}
+		s.free = make([]E, size)
+		if s.size < maxSlabSize {
+			s.size *= 2
+		}
+	}
+	out := s.free[:n:n]
+	s.free = s.free[n:]
+	return out
+}
+
+// txnArena holds the slabs that a transaction allocates its nodes, leaves,
+// edges and prefixes from, see Txn.UseArena.
+type txnArena[T any] struct {
+	nodes  slab[Node[T]]
+	leaves slab[leafNode[T]]
+	edges  slab[edge[T]]
+	bytes  slab[byte]
+}
+
+// UseArena can be used to toggle if the transaction allocates the nodes,
+// leaves, edge slices and prefixes it creates from slabs, rather than
+// making a separate heap object for each of them. This cuts the number of
+// allocations made by bulk loads and large transactions, and keeps nodes
+// created together close together in memory, which helps later iteration.
+//
+// Memory from a slab is never handed out twice, so nodes shared with other
+// trees are never overwritten. The trade-off is that a slab is only freed
+// once none of its nodes are reachable, so a tree that is updated a little
+// at a time after a bulk load may hold on to more memory than it would
+// otherwise. Clones of the transaction get slabs of their own.
+func (t *Txn[T]) UseArena(use bool) {
+	if !use {
+		t.arena = nil
+		return
+	}
+	if t.arena == nil {
+		t.arena = &txnArena[T]{}
+	}
+}
+
+// newNode returns a new empty node.
+func (t *Txn[T]) newNode() *Node[T] {
+	if t.arena == nil {
+		return &Node[T]{}
+	}
+	return &t.arena.nodes.alloc(1)[0]
+}
+
+// ownKey returns the key to keep for a key being inserted. Leaves own a copy
+// of their key, so callers can reuse the slices they insert and keys can be
+// handed out as strings without copying them. Compact trees keep no keys.
+func (t *Txn[T]) ownKey(k []byte) []byte {
+	if t.compact || k == nil {
+		return k
+	}
+	return t.copyPrefix(k)
+}
+
+// newLeaf returns a new leaf for the given key and value. Leaves of compact
+// trees don't keep the key.
+func (t *Txn[T]) newLeaf(k []byte, v T) *leafNode[T] {
+	if t.compact {
+		k = nil
+	}
+	if t.arena == nil {
+		return &leafNode[T]{key: k, val: v}
+	}
+	l := &t.arena.leaves.alloc(1)[0]
+	l.key = k
+	l.val = v
+	return l
+}
+
+// copyEdges returns a copy of the given edges. Arena copies have room for
+// one more edge, so that adding an edge to a node after copying it for
+// writing doesn't need another allocation.
+func (t *Txn[T]) copyEdges(e []edge[T]) []edge[T] {
+	var c []edge[T]
+	if t.arena == nil {
+		c = make([]edge[T], len(e))
+	} else {
+		c = t.arena.edges.alloc(len(e) + 1)[:len(e)]
+	}
+	copy(c, e)
+	return c
+}
+
+// copyPrefix returns a copy of the given prefix.
+func (t *Txn[T]) copyPrefix(p []byte) []byte {
+	var c []byte
+	if t.arena == nil || len(p) == 0 {
+		c = make([]byte, len(p))
+	} else {
+		c = t.arena.bytes.alloc(len(p))
+	}
+	copy(c, p)
+	return c
+}
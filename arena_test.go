@@ -0,0 +1,216 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestSlab_Alloc(t *testing.T) {
+	var s slab[int]
+	a := s.alloc(1)
+	b := s.alloc(1)
+	c := s.alloc(3)
+	if len(a) != 1 || cap(a) != 1 || len(c) != 3 || cap(c) != 3 {
+		t.Fatalf("bad: %d %d %d %d", len(a), cap(a), len(c), cap(c))
+	}
+
+	// Appending to a slice must not overwrite the ones after it.
+	a[0], b[0] = 1, 2
+	a = append(a, 3)
+	if b[0] != 2 {
+		t.Fatalf("bad: %d", b[0])
+	}
+
+	// Slabs double in size up to the limit, and large requests get a chunk
+	// of their own.
+	for i := 0; i < 1000; i++ {
+		s.alloc(1)
+	}
+	if s.size != maxSlabSize {
+		t.Fatalf("bad: %d", s.size)
+	}
+	if big := s.alloc(2 * maxSlabSize); len(big) != 2*maxSlabSize {
+		t.Fatalf("bad: %d", len(big))
+	}
+}
+
+// arenaContents returns the keys and values of the tree in order.
+func arenaContents(r *Tree[int]) []string {
+	var out []string
+	r.Root().Walk(func(k []byte, v int) bool {
+		out = append(out, fmt.Sprintf("%s=%d", k, v))
+		return false
+	})
+	return out
+}
+
+func TestTxn_UseArena(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	heap, arena := New[int](), New[int]()
+
+	type snapshot struct {
+		tree     *Tree[int]
+		contents []string
+	}
+	var snaps []snapshot
+
+	for round := 0; round < 20; round++ {
+		htxn, atxn := heap.Txn(), arena.Txn()
+		atxn.UseArena(true)
+		for i := 0; i < 500; i++ {
+			k := []byte(fmt.Sprintf("%x", rnd.Intn(2000)))
+			switch rnd.Intn(10) {
+			case 0:
+				htxn.Delete(k)
+				atxn.Delete(k)
+			case 1:
+				htxn.DeletePrefix(k[:1])
+				atxn.DeletePrefix(k[:1])
+			default:
+				htxn.Insert(k, i)
+				atxn.Insert(k, i)
+			}
+		}
+		heap, arena = htxn.Commit(), atxn.Commit()
+
+		want := arenaContents(heap)
+		if got := arenaContents(arena); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("bad: round %d\n%v\n%v", round, got, want)
+		}
+		if arena.Len() != heap.Len() {
+			t.Fatalf("bad: %d %d", arena.Len(), heap.Len())
+		}
+		snaps = append(snaps, snapshot{arena, want})
+	}
+
+	// Later transactions must not have changed any earlier snapshots.
+	for i, snap := range snaps {
+		if got := arenaContents(snap.tree); fmt.Sprint(got) != fmt.Sprint(snap.contents) {
+			t.Fatalf("bad: snapshot %d changed", i)
+		}
+	}
+}
+
+func TestTxn_UseArenaAfterCommit(t *testing.T) {
+	txn := New[int]().Txn()
+	txn.UseArena(true)
+	for i := 0; i < 100; i++ {
+		txn.Insert([]byte(fmt.Sprintf("key/%02d", i)), i)
+	}
+	first := txn.CommitOnly()
+	want := arenaContents(first)
+
+	// Carrying on with the same transaction keeps allocating from the same
+	// slabs, which must leave the committed tree alone.
+	txn.DeletePrefix([]byte("key/5"))
+	for i := 0; i < 100; i++ {
+		txn.Insert([]byte(fmt.Sprintf("key/%02d", i)), -i)
+		txn.Insert([]byte(fmt.Sprintf("key/%02d/sub", i)), i)
+	}
+	second := txn.Commit()
+
+	if got := arenaContents(first); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("bad: committed tree changed")
+	}
+	if second.Len() != 200 || len(arenaContents(second)) != 200 {
+		t.Fatalf("bad: %d", second.Len())
+	}
+}
+
+func TestTxn_UseArenaClone(t *testing.T) {
+	txn := New[int]().Txn()
+	txn.UseArena(true)
+	txn.Insert([]byte("a"), 1)
+
+	clone := txn.Clone()
+	if clone.arena == nil || clone.arena == txn.arena {
+		t.Fatalf("bad: clone should have its own arena")
+	}
+	txn.Insert([]byte("ab"), 2)
+	clone.Insert([]byte("ac"), 3)
+
+	if got := fmt.Sprint(arenaContents(txn.Commit())); got != "[a=1 ab=2]" {
+		t.Fatalf("bad: %s", got)
+	}
+	if got := fmt.Sprint(arenaContents(clone.Commit())); got != "[a=1 ac=3]" {
+		t.Fatalf("bad: %s", got)
+	}
+}
+
+func TestTxn_UseArenaTrackMutate(t *testing.T) {
+	r := New[int]()
+	for i := 0; i < 10; i++ {
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("key/%d", i)), i)
+	}
+	watch, _, _ := r.Root().GetWatch([]byte("key/5"))
+	other, _, _ := r.Root().GetWatch([]byte("key/6"))
+
+	txn := r.Txn()
+	txn.UseArena(true)
+	txn.TrackMutate(true)
+	txn.Insert([]byte("key/5"), 50)
+	txn.Commit()
+
+	select {
+	case <-watch:
+	default:
+		t.Fatalf("bad: channel not closed")
+	}
+	select {
+	case <-other:
+		t.Fatalf("bad: channel closed")
+	default:
+	}
+}
+
+func benchmarkTxnInsert(b *testing.B, arena bool) {
+	keys := make([][]byte, 10000)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key/%05d", i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		txn := New[int]().Txn()
+		txn.UseArena(arena)
+		for j, k := range keys {
+			txn.Insert(k, j)
+		}
+		txn.Commit()
+	}
+}
+
+func BenchmarkTxnInsert_Heap(b *testing.B) {
+	benchmarkTxnInsert(b, false)
+}
+
+func BenchmarkTxnInsert_Arena(b *testing.B) {
+	benchmarkTxnInsert(b, true)
+}
+
+func benchmarkWalk(b *testing.B, arena bool) {
+	txn := New[int]().Txn()
+	txn.UseArena(arena)
+	for i := 0; i < 100000; i++ {
+		txn.Insert([]byte(fmt.Sprintf("key/%08x", rand.Int63())), i)
+	}
+	r := txn.Commit()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Root().Walk(func(k []byte, v int) bool {
+			return false
+		})
+	}
+}
+
+func BenchmarkWalk_Heap(b *testing.B) {
+	benchmarkWalk(b, false)
+}
+
+func BenchmarkWalk_Arena(b *testing.B) {
+	benchmarkWalk(b, true)
+}
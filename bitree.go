@@ -0,0 +1,198 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+// BiTree is an immutable tree that also indexes its keys by value, so that
+// the keys currently holding a value can be found. The reverse index is a
+// second tree keyed by the escaped encoded value followed by the key, and
+// BiTreeTxn updates it alongside the forward tree for every change,
+// including DeletePrefix.
+type BiTree[T comparable] struct {
+	fwd   *Tree[T]
+	rev   *Tree[struct{}]
+	codec KeyCodec[T]
+}
+
+// NewBiTree returns an empty BiTree that encodes values with codec for the
+// reverse index. The codec doesn't need to preserve the order of values,
+// but equal values must have equal encodings.
+func NewBiTree[T comparable](codec KeyCodec[T]) *BiTree[T] {
+	return &BiTree[T]{fwd: New[T](), rev: New[struct{}](), codec: codec}
+}
+
+// Len is used to return the number of elements in the tree.
+func (b *BiTree[T]) Len() int {
+	return b.fwd.Len()
+}
+
+// Tree returns the forward tree.
+func (b *BiTree[T]) Tree() *Tree[T] {
+	return b.fwd
+}
+
+// Get is used to lookup a specific key, returning the value and if it was
+// found.
+func (b *BiTree[T]) Get(k []byte) (T, bool) {
+	return b.fwd.Get(k)
+}
+
+// KeysFor returns the keys that hold the given value, in order.
+func (b *BiTree[T]) KeysFor(v T) [][]byte {
+	return biKeysFor(b.rev.Root(), b.valuePrefix(v))
+}
+
+// KeysForWatch returns the keys that hold the given value, in order, along
+// with a watch channel that is closed when they change.
+func (b *BiTree[T]) KeysForWatch(v T) (<-chan struct{}, [][]byte) {
+	prefix := b.valuePrefix(v)
+	iter := b.rev.Root().Iterator()
+	watch := iter.SeekPrefixWatch(prefix)
+	var out [][]byte
+	for rk, _, ok := iter.Next(); ok; rk, _, ok = iter.Next() {
+		out = append(out, rk[len(prefix):])
+	}
+	return watch, out
+}
+
+// Insert is used to add or update a given key. The return provides the new
+// tree, previous value and a bool indicating if any was set.
+func (b *BiTree[T]) Insert(k []byte, v T) (*BiTree[T], T, bool) {
+	txn := b.Txn()
+	old, ok := txn.Insert(k, v)
+	return txn.Commit(), old, ok
+}
+
+// Delete is used to delete a given key. Returns the new tree, old value if
+// any, and a bool indicating if the key was set.
+func (b *BiTree[T]) Delete(k []byte) (*BiTree[T], T, bool) {
+	txn := b.Txn()
+	old, ok := txn.Delete(k)
+	return txn.Commit(), old, ok
+}
+
+// DeleteValue is used to delete every key holding the given value. Returns
+// the new tree and the number of keys deleted.
+func (b *BiTree[T]) DeleteValue(v T) (*BiTree[T], int) {
+	txn := b.Txn()
+	n := txn.DeleteValue(v)
+	return txn.Commit(), n
+}
+
+// valuePrefix returns the prefix of the reverse index keys for v.
+func (b *BiTree[T]) valuePrefix(v T) []byte {
+	return escapeKey(b.codec.AppendKey(nil, v))
+}
+
+// biKeysFor collects the keys under a value prefix of a reverse index.
+func biKeysFor(rev *Node[struct{}], prefix []byte) [][]byte {
+	var out [][]byte
+	rev.WalkPrefix(prefix, func(rk []byte, _ struct{}) bool {
+		out = append(out, rk[len(prefix):])
+		return false
+	})
+	return out
+}
+
+// BiTreeTxn is a transaction on a BiTree that keeps the reverse index in
+// step with the forward tree. Like Txn it is not thread safe.
+type BiTreeTxn[T comparable] struct {
+	fwd   *Txn[T]
+	rev   *Txn[struct{}]
+	codec KeyCodec[T]
+}
+
+// Txn starts a new transaction that can be used to mutate the tree.
+func (b *BiTree[T]) Txn() *BiTreeTxn[T] {
+	return &BiTreeTxn[T]{fwd: b.fwd.Txn(), rev: b.rev.Txn(), codec: b.codec}
+}
+
+// TrackMutate can be used to toggle if mutations are tracked, see
+// Txn.TrackMutate. It applies to both directions.
+func (t *BiTreeTxn[T]) TrackMutate(track bool) {
+	t.fwd.TrackMutate(track)
+	t.rev.TrackMutate(track)
+}
+
+// Get is used to lookup a specific key, returning the value and if it was
+// found.
+func (t *BiTreeTxn[T]) Get(k []byte) (T, bool) {
+	return t.fwd.Get(k)
+}
+
+// GetWatch is used to lookup a specific key, returning the watch channel,
+// value and if it was found.
+func (t *BiTreeTxn[T]) GetWatch(k []byte) (<-chan struct{}, T, bool) {
+	return t.fwd.GetWatch(k)
+}
+
+// KeysFor returns the keys that hold the given value, in order.
+func (t *BiTreeTxn[T]) KeysFor(v T) [][]byte {
+	return biKeysFor(t.rev.Root(), t.valuePrefix(v))
+}
+
+// Insert is used to add or update a given key. The return provides the
+// previous value and a bool indicating if any was set.
+func (t *BiTreeTxn[T]) Insert(k []byte, v T) (T, bool) {
+	old, ok := t.fwd.Insert(k, v)
+	if ok && old == v {
+		return old, ok
+	}
+	if ok {
+		t.rev.Delete(t.reverseKey(old, k))
+	}
+	t.rev.Insert(t.reverseKey(v, k), struct{}{})
+	return old, ok
+}
+
+// Delete is used to delete a given key. Returns the old value if any, and a
+// bool indicating if the key was set.
+func (t *BiTreeTxn[T]) Delete(k []byte) (T, bool) {
+	old, ok := t.fwd.Delete(k)
+	if ok {
+		t.rev.Delete(t.reverseKey(old, k))
+	}
+	return old, ok
+}
+
+// DeletePrefix is used to delete an entire subtree that matches the prefix.
+// This will delete all nodes under that prefix, along with their reverse
+// index entries.
+func (t *BiTreeTxn[T]) DeletePrefix(prefix []byte) bool {
+	t.fwd.Root().WalkPrefix(prefix, func(k []byte, v T) bool {
+		t.rev.Delete(t.reverseKey(v, k))
+		return false
+	})
+	return t.fwd.DeletePrefix(prefix)
+}
+
+// DeleteValue is used to delete every key holding the given value. Returns
+// the number of keys deleted.
+func (t *BiTreeTxn[T]) DeleteValue(v T) int {
+	prefix := t.valuePrefix(v)
+	keys := biKeysFor(t.rev.Root(), prefix)
+	for _, k := range keys {
+		t.fwd.Delete(k)
+	}
+	t.rev.DeletePrefix(prefix)
+	return len(keys)
+}
+
+// Commit is used to finalize the transaction and return a new tree. If
+// mutation tracking is turned on then notifications will be issued once
+// both directions have been committed.
+func (t *BiTreeTxn[T]) Commit() *BiTree[T] {
+	nb := &BiTree[T]{fwd: t.fwd.CommitOnly(), rev: t.rev.CommitOnly(), codec: t.codec}
+	t.fwd.Notify()
+	t.rev.Notify()
+	return nb
+}
+
+func (t *BiTreeTxn[T]) valuePrefix(v T) []byte {
+	return escapeKey(t.codec.AppendKey(nil, v))
+}
+
+// reverseKey returns the key of the reverse index entry for k holding v.
+func (t *BiTreeTxn[T]) reverseKey(v T, k []byte) []byte {
+	return append(t.valuePrefix(v), k...)
+}
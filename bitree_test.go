@@ -0,0 +1,89 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func biKeys(keys [][]byte) []string {
+	out := []string{}
+	for _, k := range keys {
+		out = append(out, string(k))
+	}
+	return out
+}
+
+func TestBiTree(t *testing.T) {
+	b := NewBiTree[string](StringKeyCodec{})
+	txn := b.Txn()
+	txn.Insert([]byte("node/1"), "up")
+	txn.Insert([]byte("node/2"), "down")
+	txn.Insert([]byte("node/3"), "up")
+	txn.Insert([]byte("svc/1"), "up")
+	b = txn.Commit()
+
+	if got := biKeys(b.KeysFor("up")); !reflect.DeepEqual(got, []string{"node/1", "node/3", "svc/1"}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Changing a value moves the key in the reverse index.
+	b2, old, ok := b.Insert([]byte("node/3"), "down")
+	if !ok || old != "up" {
+		t.Fatalf("bad: %v", old)
+	}
+	if got := biKeys(b2.KeysFor("down")); !reflect.DeepEqual(got, []string{"node/2", "node/3"}) {
+		t.Fatalf("bad: %v", got)
+	}
+	if got := biKeys(b.KeysFor("down")); !reflect.DeepEqual(got, []string{"node/2"}) {
+		t.Fatalf("old tree changed: %v", got)
+	}
+
+	b3, n := b2.DeleteValue("down")
+	if n != 2 || b3.Len() != 2 {
+		t.Fatalf("bad: %d %d", n, b3.Len())
+	}
+	if _, ok := b3.Get([]byte("node/2")); ok {
+		t.Fatalf("node/2 should be deleted")
+	}
+
+	b4, _, _ := b3.Delete([]byte("svc/1"))
+	if got := biKeys(b4.KeysFor("up")); !reflect.DeepEqual(got, []string{"node/1"}) {
+		t.Fatalf("bad: %v", got)
+	}
+}
+
+func TestBiTreeTxn_DeletePrefix(t *testing.T) {
+	b := NewBiTree[int](IntKeyCodec[int]{})
+	txn := b.Txn()
+	txn.Insert([]byte("a/1"), 1)
+	txn.Insert([]byte("a/2"), 2)
+	txn.Insert([]byte("b/1"), 1)
+	b = txn.Commit()
+
+	watch, keys := b.KeysForWatch(1)
+	if len(keys) != 2 {
+		t.Fatalf("bad: %v", biKeys(keys))
+	}
+
+	txn = b.Txn()
+	txn.TrackMutate(true)
+	if !txn.DeletePrefix([]byte("a/")) {
+		t.Fatalf("should delete")
+	}
+	if got := biKeys(txn.KeysFor(1)); !reflect.DeepEqual(got, []string{"b/1"}) {
+		t.Fatalf("bad: %v", got)
+	}
+	b = txn.Commit()
+
+	if b.rev.Len() != b.Len() {
+		t.Fatalf("reverse index out of sync: %d %d", b.rev.Len(), b.Len())
+	}
+	select {
+	case <-watch:
+	default:
+		t.Fatalf("watch should fire")
+	}
+}
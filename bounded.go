@@ -0,0 +1,280 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import "encoding/binary"
+
+// EvictionPolicy selects which entries a BoundedTree evicts first.
+type EvictionPolicy int
+
+const (
+	// EvictLRU evicts the least recently used entry first.
+	EvictLRU EvictionPolicy = iota
+
+	// EvictLFU evicts the least frequently used entry first, with ties
+	// broken by evicting the least recently used of them.
+	EvictLFU
+)
+
+// BoundedConfig sets the limits of a BoundedTree. A zero limit is not
+// enforced.
+type BoundedConfig[T any] struct {
+	// MaxEntries is the maximum number of entries.
+	MaxEntries int
+
+	// MaxWeight is the maximum total weight of the entries, as reported by
+	// Sizer.
+	MaxWeight int64
+
+	// Sizer returns the weight of an entry. If it is nil every entry weighs
+	// 1, in which case MaxWeight limits the number of entries just like
+	// MaxEntries.
+	Sizer func(k []byte, v T) int64
+
+	// Policy selects which entries are evicted first.
+	Policy EvictionPolicy
+}
+
+// boundedMeta is the access tracking state of an entry in a BoundedTree.
+type boundedMeta struct {
+	// tick is the value of the tree's logical clock when the entry was last
+	// used.
+	tick uint64
+
+	// freq is the number of times the entry has been used.
+	freq uint64
+
+	weight int64
+}
+
+// Evicted is an entry that a BoundedTxn evicted to stay within its limits.
+type Evicted[T any] struct {
+	Key []byte
+	Val T
+}
+
+// BoundedTree is an immutable tree that holds a limited number of entries,
+// or entries up to a limited total weight, evicting entries by recency or
+// frequency of use when a transaction goes over the limit. Uses are only
+// recorded by transactions, so reading an older BoundedTree never changes
+// it and snapshots stay immutable.
+type BoundedTree[T any] struct {
+	entries *Tree[T]
+
+	// meta holds the access tracking state of every entry. It is kept
+	// apart from the entries so that recording a use doesn't trigger
+	// watches on the entry.
+	meta *Tree[boundedMeta]
+
+	// order holds a key for every entry that sorts in eviction order, see
+	// orderKey.
+	order *Tree[struct{}]
+
+	tick   uint64
+	weight int64
+	conf   BoundedConfig[T]
+}
+
+// NewBounded returns an empty BoundedTree with the given limits.
+func NewBounded[T any](conf BoundedConfig[T]) *BoundedTree[T] {
+	if conf.Sizer == nil {
+		conf.Sizer = func([]byte, T) int64 { return 1 }
+	}
+	return &BoundedTree[T]{
+		entries: New[T](),
+		meta:    New[boundedMeta](),
+		order:   New[struct{}](),
+		conf:    conf,
+	}
+}
+
+// Len is used to return the number of entries in the tree.
+func (b *BoundedTree[T]) Len() int {
+	return b.entries.Len()
+}
+
+// Weight returns the total weight of the entries in the tree.
+func (b *BoundedTree[T]) Weight() int64 {
+	return b.weight
+}
+
+// Get is used to lookup a specific key, returning the value and if it was
+// found. It does not count as a use of the entry, use BoundedTxn.Get for
+// that.
+func (b *BoundedTree[T]) Get(k []byte) (T, bool) {
+	return b.entries.Get(k)
+}
+
+// Root returns the root node of the entries, which can be used for richer
+// query operations. Reads through it do not count as uses.
+func (b *BoundedTree[T]) Root() *Node[T] {
+	return b.entries.Root()
+}
+
+// BoundedTxn is a transaction on a BoundedTree. Like Txn it is not thread
+// safe.
+type BoundedTxn[T any] struct {
+	entries *Txn[T]
+	meta    *Txn[boundedMeta]
+	order   *Txn[struct{}]
+
+	tick    uint64
+	weight  int64
+	conf    BoundedConfig[T]
+	evicted []Evicted[T]
+}
+
+// Txn starts a new transaction that can be used to mutate the tree.
+func (b *BoundedTree[T]) Txn() *BoundedTxn[T] {
+	return &BoundedTxn[T]{
+		entries: b.entries.Txn(),
+		meta:    b.meta.Txn(),
+		order:   b.order.Txn(),
+		tick:    b.tick,
+		weight:  b.weight,
+		conf:    b.conf,
+	}
+}
+
+// TrackMutate can be used to toggle if mutations of the entries are
+// tracked, see Txn.TrackMutate. Uses recorded by Get don't count as
+// mutations.
+func (t *BoundedTxn[T]) TrackMutate(track bool) {
+	t.entries.TrackMutate(track)
+}
+
+// Get is used to lookup a specific key, returning the value and if it was
+// found. A found entry is recorded as used.
+func (t *BoundedTxn[T]) Get(k []byte) (T, bool) {
+	v, ok := t.entries.Get(k)
+	if ok {
+		m, _ := t.meta.Get(k)
+		t.use(k, m)
+	}
+	return v, ok
+}
+
+// Insert is used to add or update a given key, recording it as used. Other
+// entries are then evicted until the tree is back within its limits; the
+// entry being inserted is never evicted by its own insert. The return
+// provides the previous value and a bool indicating if any was set.
+func (t *BoundedTxn[T]) Insert(k []byte, v T) (T, bool) {
+	old, ok := t.entries.Insert(k, v)
+	m, _ := t.meta.Get(k)
+	if ok {
+		t.weight -= m.weight
+	}
+	m.weight = t.conf.Sizer(k, v)
+	t.weight += m.weight
+	t.use(k, m)
+	t.evict(k)
+	return old, ok
+}
+
+// Delete is used to delete a given key. Returns the old value if any, and a
+// bool indicating if the key was set.
+func (t *BoundedTxn[T]) Delete(k []byte) (T, bool) {
+	old, ok := t.entries.Delete(k)
+	if ok {
+		m, _ := t.meta.Delete(k)
+		t.order.Delete(t.orderKey(k, m))
+		t.weight -= m.weight
+	}
+	return old, ok
+}
+
+// Evicted returns the entries evicted so far by this transaction, in the
+// order they were evicted.
+func (t *BoundedTxn[T]) Evicted() []Evicted[T] {
+	return t.evicted
+}
+
+// Commit is used to finalize the transaction and return a new tree. If
+// mutation tracking is turned on then notifications will also be issued.
+func (t *BoundedTxn[T]) Commit() *BoundedTree[T] {
+	return &BoundedTree[T]{
+		entries: t.entries.Commit(),
+		meta:    t.meta.Commit(),
+		order:   t.order.Commit(),
+		tick:    t.tick,
+		weight:  t.weight,
+		conf:    t.conf,
+	}
+}
+
+// use records a use of k, whose current access state is m, moving it to
+// its new place in the eviction order.
+func (t *BoundedTxn[T]) use(k []byte, m boundedMeta) {
+	if m.freq > 0 {
+		t.order.Delete(t.orderKey(k, m))
+	}
+	t.tick++
+	m.tick = t.tick
+	m.freq++
+	t.meta.Insert(k, m)
+	t.order.Insert(t.orderKey(k, m), struct{}{})
+}
+
+// overLimit returns true if the transaction holds more than its limits.
+func (t *BoundedTxn[T]) overLimit() bool {
+	if t.conf.MaxEntries > 0 && t.entries.size > t.conf.MaxEntries {
+		return true
+	}
+	return t.conf.MaxWeight > 0 && t.weight > t.conf.MaxWeight
+}
+
+// evict removes entries in eviction order, other than keep, until the
+// transaction is back within its limits.
+func (t *BoundedTxn[T]) evict(keep []byte) {
+	if !t.overLimit() {
+		return
+	}
+
+	var victims [][]byte
+	iter := t.order.Root().Iterator()
+	for t.overLimit() {
+		ik, _, ok := iter.Next()
+		if !ok {
+			break
+		}
+		k := ik[t.orderPrefixSize():]
+		if string(k) == string(keep) {
+			continue
+		}
+		victims = append(victims, ik)
+
+		v, _ := t.entries.Delete(k)
+		m, _ := t.meta.Delete(k)
+		t.weight -= m.weight
+		t.evicted = append(t.evicted, Evicted[T]{Key: k, Val: v})
+	}
+
+	// The order index can't be changed while it is being iterated.
+	for _, ik := range victims {
+		t.order.Delete(ik)
+	}
+}
+
+// orderPrefixSize is the size of the part of an order key in front of the
+// entry's key.
+func (t *BoundedTxn[T]) orderPrefixSize() int {
+	if t.conf.Policy == EvictLFU {
+		return 16
+	}
+	return 8
+}
+
+// orderKey returns the key of an entry in the order index. For LRU this is
+// the big-endian tick followed by the key, and for LFU the big-endian
+// frequency is put in front of that.
+func (t *BoundedTxn[T]) orderKey(k []byte, m boundedMeta) []byte {
+	out := make([]byte, t.orderPrefixSize(), t.orderPrefixSize()+len(k))
+	if t.conf.Policy == EvictLFU {
+		binary.BigEndian.PutUint64(out, m.freq)
+		binary.BigEndian.PutUint64(out[8:], m.tick)
+	} else {
+		binary.BigEndian.PutUint64(out, m.tick)
+	}
+	return append(out, k...)
+}
@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func evictedKeys[T any](evicted []Evicted[T]) []string {
+	var out []string
+	for _, e := range evicted {
+		out = append(out, string(e.Key))
+	}
+	return out
+}
+
+func TestBoundedTree_LRU(t *testing.T) {
+	b := NewBounded(BoundedConfig[int]{MaxEntries: 3})
+
+	txn := b.Txn()
+	txn.Insert([]byte("a"), 1)
+	txn.Insert([]byte("b"), 2)
+	txn.Insert([]byte("c"), 3)
+	b = txn.Commit()
+
+	old := b
+	txn = b.Txn()
+	txn.Get([]byte("a"))
+	txn.Insert([]byte("d"), 4)
+	txn.Insert([]byte("e"), 5)
+	b = txn.Commit()
+
+	if got := evictedKeys(txn.Evicted()); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Fatalf("bad: %v", got)
+	}
+	if v := txn.Evicted()[0].Val; v != 2 {
+		t.Fatalf("bad: %v", v)
+	}
+	if b.Len() != 3 {
+		t.Fatalf("bad len: %d", b.Len())
+	}
+	for _, k := range []string{"a", "d", "e"} {
+		if _, ok := b.Get([]byte(k)); !ok {
+			t.Fatalf("missing %q", k)
+		}
+	}
+
+	// The older snapshot is untouched.
+	if old.Len() != 3 || old.tick != 3 {
+		t.Fatalf("old snapshot changed")
+	}
+	if _, ok := old.Get([]byte("b")); !ok {
+		t.Fatalf("old snapshot changed")
+	}
+}
+
+func TestBoundedTree_LFU(t *testing.T) {
+	b := NewBounded(BoundedConfig[int]{MaxEntries: 2, Policy: EvictLFU})
+
+	txn := b.Txn()
+	txn.Insert([]byte("a"), 1)
+	txn.Insert([]byte("b"), 2)
+	txn.Get([]byte("a"))
+	txn.Get([]byte("b"))
+	txn.Get([]byte("a"))
+
+	// The new key has the lowest frequency but is never evicted by its own
+	// insert, so b goes.
+	txn.Insert([]byte("c"), 3)
+	if got := evictedKeys(txn.Evicted()); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Now c is the least frequently used.
+	txn.Insert([]byte("d"), 4)
+	if got := evictedKeys(txn.Evicted()); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Fatalf("bad: %v", got)
+	}
+	b = txn.Commit()
+	if b.order.Len() != b.Len() || b.meta.Len() != b.Len() {
+		t.Fatalf("indexes out of step: %d %d %d", b.Len(), b.order.Len(), b.meta.Len())
+	}
+}
+
+func TestBoundedTree_Weight(t *testing.T) {
+	b := NewBounded(BoundedConfig[string]{
+		MaxWeight: 10,
+		Sizer:     func(k []byte, v string) int64 { return int64(len(v)) },
+	})
+
+	txn := b.Txn()
+	txn.Insert([]byte("a"), "xxxx")
+	txn.Insert([]byte("b"), "xxxx")
+	txn.Insert([]byte("c"), "xxx")
+	if got := evictedKeys(txn.Evicted()); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Growing an entry in place updates the weight.
+	txn.Insert([]byte("c"), "xxxxxxx")
+	if got := evictedKeys(txn.Evicted()); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("bad: %v", got)
+	}
+	txn.Delete([]byte("c"))
+	b = txn.Commit()
+	if b.Len() != 0 || b.Weight() != 0 {
+		t.Fatalf("bad: %d %d", b.Len(), b.Weight())
+	}
+}
@@ -0,0 +1,13 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+// Codec is used to convert values stored in a tree to and from bytes, for
+// operations that need to hash values or move them outside the process.
+// Encode must be deterministic, since equal values are expected to produce
+// equal bytes.
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(b []byte) (T, error)
+}
@@ -0,0 +1,96 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+// Option configures a Tree created by New.
+type Option func(*options)
+
+type options struct {
+	compact bool
+}
+
+// CompactKeys makes a tree that doesn't store the keys of its leaves. A
+// leaf's key is the concatenation of the prefixes on the path to it, so
+// iterators, walks and lookups rebuild keys from the path instead, and
+// inserts copy just the part of each key that isn't shared with other keys
+// rather than keeping the whole key around. For keys with long shared
+// prefixes this uses much less memory, in exchange for allocating a copy of
+// the key each time one is returned.
+//
+// Trees derived from a compact tree through transactions are also compact.
+func CompactKeys() Option {
+	return func(o *options) {
+		o.compact = true
+	}
+}
+
+// isCompact returns true if n belongs to a compact tree. Compact trees are
+// told apart by their leaves, which have no key. Only the root of a tree has
+// no prefix, and its leaf may have an empty key in any tree, so it's passed
+// over for the first leaf below it.
+func (n *Node[T]) isCompact() bool {
+	for {
+		if n.leaf != nil && (n.leaf.key != nil || len(n.prefix) > 0) {
+			return n.leaf.key == nil
+		}
+		if len(n.edges) == 0 {
+			return false
+		}
+		n = n.edges[0].node
+	}
+}
+
+// keyAt returns the key of a leaf whose path is path. Leaves of compact
+// trees have no key, so they get a copy of the path. Callers that don't
+// track the path pass nil, which is only done for trees that aren't
+// compact, where every leaf with a nil key is at the root.
+func (l *leafNode[T]) keyAt(path []byte) []byte {
+	if l.key != nil || len(path) == 0 {
+		return l.key
+	}
+	k := make([]byte, len(path))
+	copy(k, path)
+	return k
+}
+
+// keyAtPath is like keyAt, but takes the path as a string, which is only
+// converted if the leaf has no key.
+func (l *leafNode[T]) keyAtPath(path string) []byte {
+	if l.key != nil || len(path) == 0 {
+		return l.key
+	}
+	return []byte(path)
+}
+
+// ownPrefix returns the prefix to use for a new node from a slice of a key
+// being inserted. Compact trees copy it, so the tree doesn't hold on to the
+// rest of the key.
+func (t *Txn[T]) ownPrefix(p []byte) []byte {
+	if !t.compact {
+		return p
+	}
+	return t.copyPrefix(p)
+}
+
+// compactWalk is like recursiveWalk, but for compact trees. path is the
+// path to the parent of n, and is reused as the walk goes on.
+func compactWalk[T any](n *Node[T], path []byte, reverse bool, fn WalkFn[T]) bool {
+	path = append(path, n.prefix...)
+
+	// Visit the leaf values if any
+	if n.leaf != nil && fn(n.leaf.keyAt(path), n.leaf.val) {
+		return true
+	}
+
+	// Recurse on the children
+	for i := range n.edges {
+		if reverse {
+			i = len(n.edges) - 1 - i
+		}
+		if compactWalk(n.edges[i].node, path, reverse, fn) {
+			return true
+		}
+	}
+	return false
+}
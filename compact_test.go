@@ -0,0 +1,309 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// compactPair builds a normal and a compact tree with the same random
+// contents, and returns the keys that were used.
+func compactPair(t testing.TB, seed int64) (*Tree[int], *Tree[int], [][]byte) {
+	rnd := rand.New(rand.NewSource(seed))
+	var keys [][]byte
+	for i := 0; i < 300; i++ {
+		k := make([]byte, rnd.Intn(6))
+		for j := range k {
+			k[j] = "abc/"[rnd.Intn(4)]
+		}
+		keys = append(keys, k)
+	}
+
+	normal, compact := New[int](), New[int](CompactKeys())
+	for round := 0; round < 3; round++ {
+		ntxn, ctxn := normal.Txn(), compact.Txn()
+		for i, k := range keys {
+			switch rnd.Intn(8) {
+			case 0:
+				ntxn.Delete(k)
+				ctxn.Delete(k)
+			case 1:
+				ntxn.DeletePrefix(k)
+				ctxn.DeletePrefix(k)
+			default:
+				ntxn.Insert(k, i)
+				ctxn.Insert(k, i)
+			}
+		}
+		normal, compact = ntxn.Commit(), ctxn.Commit()
+	}
+	return normal, compact, keys
+}
+
+type kv struct {
+	K string
+	V int
+}
+
+func collectWalk(walk func(fn WalkFn[int])) []kv {
+	var out []kv
+	walk(func(k []byte, v int) bool {
+		out = append(out, kv{string(k), v})
+		return false
+	})
+	return out
+}
+
+func collectIter(next func() ([]byte, int, bool)) []kv {
+	var out []kv
+	for k, v, ok := next(); ok; k, v, ok = next() {
+		out = append(out, kv{string(k), v})
+	}
+	return out
+}
+
+func TestCompactKeys(t *testing.T) {
+	for seed := int64(0); seed < 10; seed++ {
+		normal, compact, keys := compactPair(t, seed)
+		n, c := normal.Root(), compact.Root()
+		if !compact.compact || normal.compact || !c.isCompact() || n.isCompact() {
+			t.Fatalf("bad: compact flag")
+		}
+
+		check := func(what string, want, got interface{}) {
+			t.Helper()
+			if !reflect.DeepEqual(want, got) {
+				t.Fatalf("bad: seed %d %s\nwant %v\ngot  %v", seed, what, want, got)
+			}
+		}
+
+		// No leaf should have kept its key.
+		for iter := c.rawIterator(); iter.Front() != nil; iter.Next() {
+			if l := iter.Front().leaf; l != nil && l.key != nil {
+				t.Fatalf("bad: leaf %q kept its key", l.key)
+			}
+		}
+
+		check("len", normal.Len(), compact.Len())
+		check("walk", collectWalk(n.Walk), collectWalk(c.Walk))
+		check("walk backwards", collectWalk(n.WalkBackwards), collectWalk(c.WalkBackwards))
+		check("iterator", collectIter(n.Iterator().Next), collectIter(c.Iterator().Next))
+		check("reverse iterator", collectIter(n.ReverseIterator().Previous), collectIter(c.ReverseIterator().Previous))
+
+		nk, nv, nok := n.Minimum()
+		ck, cv, cok := c.Minimum()
+		check("minimum", kv{string(nk), nv}, kv{string(ck), cv})
+		check("minimum ok", nok, cok)
+		nk, nv, nok = n.Maximum()
+		ck, cv, cok = c.Maximum()
+		check("maximum", kv{string(nk), nv}, kv{string(ck), cv})
+		check("maximum ok", nok, cok)
+
+		for _, k := range keys {
+			search := append(append([]byte{}, k...), 'b')
+			check("walk prefix "+string(k), collectWalk(func(fn WalkFn[int]) { n.WalkPrefix(k, fn) }),
+				collectWalk(func(fn WalkFn[int]) { c.WalkPrefix(k, fn) }))
+			check("walk path "+string(search), collectWalk(func(fn WalkFn[int]) { n.WalkPath(search, fn) }),
+				collectWalk(func(fn WalkFn[int]) { c.WalkPath(search, fn) }))
+
+			nk, nv, nok := n.LongestPrefix(search)
+			ck, cv, cok := c.LongestPrefix(search)
+			check("longest prefix "+string(search), kv{string(nk), nv}, kv{string(ck), cv})
+			check("longest prefix ok", nok, cok)
+
+			ni, ci := n.Iterator(), c.Iterator()
+			ni.SeekPrefix(k)
+			ci.SeekPrefix(k)
+			check("seek prefix "+string(k), collectIter(ni.Next), collectIter(ci.Next))
+
+			ni, ci = n.Iterator(), c.Iterator()
+			ni.SeekLowerBound(k)
+			ci.SeekLowerBound(k)
+			check("seek lower bound "+string(k), collectIter(ni.Next), collectIter(ci.Next))
+
+			nri, cri := n.ReverseIterator(), c.ReverseIterator()
+			nri.SeekPrefix(k)
+			cri.SeekPrefix(k)
+			check("reverse seek prefix "+string(k), collectIter(nri.Previous), collectIter(cri.Previous))
+
+			nri, cri = n.ReverseIterator(), c.ReverseIterator()
+			nri.SeekReverseLowerBound(k)
+			cri.SeekReverseLowerBound(k)
+			check("seek reverse lower bound "+string(k), collectIter(nri.Previous), collectIter(cri.Previous))
+		}
+	}
+}
+
+func TestCompactKeys_Detect(t *testing.T) {
+	cases := []struct {
+		compact bool
+		keys    []string
+	}{
+		{false, nil},
+		{false, []string{""}},
+		{false, []string{"", "a"}},
+		{false, []string{"a", "ab"}},
+		{true, []string{""}},
+		{true, []string{"", "a"}},
+		{true, []string{"a", "ab", "b"}},
+	}
+	for _, c := range cases {
+		var opts []Option
+		if c.compact {
+			opts = append(opts, CompactKeys())
+		}
+		r := New[int](opts...)
+		for i, k := range c.keys {
+			var key []byte
+			if k != "" {
+				key = []byte(k)
+			}
+			r, _, _ = r.Insert(key, i)
+		}
+
+		// A tree with nothing but a leaf at the root looks the same
+		// either way, and its key is empty either way.
+		want := c.compact && len(c.keys) > 1
+		if got := r.Root().isCompact(); got != want {
+			t.Fatalf("bad: %v %q: %v", c.compact, c.keys, got)
+		}
+		var got []string
+		r.Root().Walk(func(k []byte, _ int) bool {
+			got = append(got, string(k))
+			return false
+		})
+		if !reflect.DeepEqual(got, c.keys) {
+			t.Fatalf("bad: %v %q: %q", c.compact, c.keys, got)
+		}
+	}
+}
+
+func TestCompactKeys_Diff(t *testing.T) {
+	_, before, _ := compactPair(t, 1)
+	txn := before.Txn()
+	txn.Insert([]byte("new/key"), 1)
+	txn.DeletePrefix([]byte("a"))
+	after := txn.Commit()
+
+	var want []string
+	diffNodes(before.Root(), before.Root(), func(k []byte, _, _ *leafNode[int]) bool {
+		t.Fatalf("bad: identical trees differ at %q", k)
+		return false
+	})
+	before.Root().WalkPrefix([]byte("a"), func(k []byte, _ int) bool {
+		want = append(want, string(k))
+		return false
+	})
+	want = append(want, "new/key")
+
+	var got []string
+	diffNodes(before.Root(), after.Root(), func(k []byte, _, _ *leafNode[int]) bool {
+		got = append(got, string(k))
+		return false
+	})
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("bad: %v %v", got, want)
+	}
+}
+
+func TestCompactKeys_Reconcile(t *testing.T) {
+	normal, compact := New[string](), New[string](CompactKeys())
+	for i := 0; i < 1000; i++ {
+		k := fmt.Sprintf("key/%04d", i)
+		normal, _, _ = normal.Insert([]byte(k), k)
+		compact, _, _ = compact.Insert([]byte(k), k)
+	}
+
+	// Compact trees hash their entries the same way, so identical
+	// contents need nothing sent.
+	_, _, tr := reconcilePair(t, normal, compact, ReconcileConfig[string]{Codec: stringCodec{}})
+	if tr.sent != 0 {
+		t.Fatalf("bad: %d sent", tr.sent)
+	}
+
+	compact, _, _ = compact.Insert([]byte("key/0042"), "changed")
+	l, r, _ := reconcilePair(t, normal, compact, ReconcileConfig[string]{Codec: stringCodec{}})
+	if !reflect.DeepEqual(treeContents(l), treeContents(r)) {
+		t.Fatalf("trees did not converge")
+	}
+	if !r.compact || !r.Root().isCompact() {
+		t.Fatalf("bad: reconciled tree is not compact")
+	}
+}
+
+func TestCompactKeys_DoesNotRetainKeys(t *testing.T) {
+	r := New[int](CompactKeys())
+	k := []byte("shared/prefix/one")
+	r, _, _ = r.Insert(k, 1)
+
+	// Changing the caller's key must not affect the tree.
+	copy(k, "XXXXXXXXXXXXXXXXX")
+	if v, ok := r.Get([]byte("shared/prefix/one")); !ok || v != 1 {
+		t.Fatalf("bad: %v %v", v, ok)
+	}
+}
+
+// benchmarkMemoryPerEntry reports the heap used per entry by a tree with
+// long shared key prefixes.
+func benchmarkMemoryPerEntry(b *testing.B, opts ...Option) {
+	const entries = 100000
+	var perEntry float64
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		runtime.GC()
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		b.StartTimer()
+
+		txn := New[int](opts...).Txn()
+		for j := 0; j < entries; j++ {
+			k := fmt.Sprintf("/registry/services/endpoints/default/service-%06d/instance", j)
+			txn.Insert([]byte(k), j)
+		}
+		r := txn.Commit()
+
+		b.StopTimer()
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		perEntry = float64(after.HeapAlloc-before.HeapAlloc) / entries
+		runtime.KeepAlive(r)
+		b.StartTimer()
+	}
+	b.ReportMetric(perEntry, "B/entry")
+}
+
+func BenchmarkMemoryPerEntry(b *testing.B) {
+	benchmarkMemoryPerEntry(b)
+}
+
+func BenchmarkMemoryPerEntry_Compact(b *testing.B) {
+	benchmarkMemoryPerEntry(b, CompactKeys())
+}
+
+func benchmarkIterate(b *testing.B, opts ...Option) {
+	txn := New[int](opts...).Txn()
+	for j := 0; j < 10000; j++ {
+		txn.Insert([]byte(fmt.Sprintf("/registry/services/service-%06d", j)), j)
+	}
+	r := txn.Commit()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		iter := r.Root().Iterator()
+		for _, _, ok := iter.Next(); ok; _, _, ok = iter.Next() {
+		}
+	}
+}
+
+func BenchmarkIterate(b *testing.B) {
+	benchmarkIterate(b)
+}
+
+func BenchmarkIterate_Compact(b *testing.B) {
+	benchmarkIterate(b, CompactKeys())
+}
@@ -0,0 +1,77 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import "strings"
+
+// diffFn is called by diffNodes for every key whose leaf differs between the
+// two trees. Either leaf is nil if the key is missing on that side. Returns
+// true if the diff should be aborted.
+type diffFn[T any] func(k []byte, old, new *leafNode[T]) bool
+
+// diffNodes calls fn in key order for every key whose leaf differs between
+// the trees rooted at a and b. Subtrees that are shared between the two
+// trees are skipped without being visited, so the cost is proportional to
+// the size of the change rather than the size of the trees when b was
+// derived from a by a transaction, or vice versa.
+func diffNodes[T any](a, b *Node[T], fn diffFn[T]) {
+	aIter, bIter := a.rawIterator(), b.rawIterator()
+	for aIter.Front() != nil || bIter.Front() != nil {
+		aElem, bElem := aIter.Front(), bIter.Front()
+
+		// Once one side is exhausted, everything left on the other side
+		// is either a removal or an addition.
+		if bElem == nil {
+			if aElem.leaf != nil && fn(aElem.leaf.keyAtPath(aIter.Path()), aElem.leaf, nil) {
+				return
+			}
+			aIter.Next()
+			continue
+		}
+		if aElem == nil {
+			if bElem.leaf != nil && fn(bElem.leaf.keyAtPath(bIter.Path()), nil, bElem.leaf) {
+				return
+			}
+			bIter.Next()
+			continue
+		}
+
+		// The raw iterators visit nodes in path order, so this works the
+		// same way as the merge in slowNotify.
+		cmp := strings.Compare(aIter.Path(), bIter.Path())
+		switch {
+		case cmp < 0:
+			if aElem.leaf != nil && fn(aElem.leaf.keyAtPath(aIter.Path()), aElem.leaf, nil) {
+				return
+			}
+			aIter.Next()
+
+		case cmp > 0:
+			if bElem.leaf != nil && fn(bElem.leaf.keyAtPath(bIter.Path()), nil, bElem.leaf) {
+				return
+			}
+			bIter.Next()
+
+		default:
+			// A node shared by both trees has identical contents, so
+			// there's no need to look at anything below it.
+			if aElem == bElem {
+				aIter.skipChildren()
+				bIter.skipChildren()
+			} else if aElem.leaf != bElem.leaf {
+				var k []byte
+				if aElem.leaf != nil {
+					k = aElem.leaf.keyAtPath(aIter.Path())
+				} else {
+					k = bElem.leaf.keyAtPath(bIter.Path())
+				}
+				if fn(k, aElem.leaf, bElem.leaf) {
+					return
+				}
+			}
+			aIter.Next()
+			bIter.Next()
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestDiffNodes(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() []byte {
+		k := make([]byte, rnd.Intn(4))
+		for i := range k {
+			k[i] = "abc"[rnd.Intn(3)]
+		}
+		return k
+	}
+
+	for i := 0; i < 200; i++ {
+		a := New[int]()
+		for j := 0; j < rnd.Intn(30); j++ {
+			a, _, _ = a.Insert(randKey(), j)
+		}
+
+		txn := a.Txn()
+		want := make(map[string]bool)
+		for j := 0; j < rnd.Intn(10); j++ {
+			k := randKey()
+			if rnd.Intn(2) == 0 {
+				txn.Insert(k, -j-1)
+				want[string(k)] = true
+			} else if _, ok := txn.Delete(k); ok {
+				want[string(k)] = true
+			}
+		}
+		b := txn.Commit()
+
+		// A key that was inserted and then deleted again isn't a change,
+		// so compare against the values rather than the operations.
+		got := make(map[string]bool)
+		var last []byte
+		diffNodes(a.root, b.root, func(k []byte, old, new *leafNode[int]) bool {
+			if last != nil && string(k) <= string(last) {
+				t.Fatalf("out of order: %q after %q", k, last)
+			}
+			last = k
+			av, aok := a.Get(k)
+			bv, bok := b.Get(k)
+			if (old != nil) != aok || (new != nil) != bok {
+				t.Fatalf("bad leaves for %q", k)
+			}
+			if aok && bok && av == bv {
+				t.Fatalf("reported unchanged key %q", k)
+			}
+			got[string(k)] = true
+			return false
+		})
+		for k := range want {
+			av, aok := a.Get([]byte(k))
+			bv, bok := b.Get([]byte(k))
+			if aok == bok && av == bv {
+				delete(want, k)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
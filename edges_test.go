@@ -0,0 +1,230 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// checkEdges checks every way of finding an edge in n against a linear
+// scan of its edges.
+func checkEdges[T any](t *testing.T, n *Node[T]) {
+	t.Helper()
+	for i := 1; i < len(n.edges); i++ {
+		if n.edges[i-1].label >= n.edges[i].label {
+			t.Fatalf("edges out of order at %d", i)
+		}
+	}
+	for l := 0; l < 256; l++ {
+		label := byte(l)
+		wantIdx, wantLB := -1, -1
+		for i, e := range n.edges {
+			if e.label == label {
+				wantIdx = i
+			}
+			if e.label >= label && wantLB == -1 {
+				wantLB = i
+			}
+		}
+		if idx, _ := n.getEdge(label); idx != wantIdx {
+			t.Fatalf("getEdge(%d) with %d edges: %d != %d", l, len(n.edges), idx, wantIdx)
+		}
+		if idx, _ := n.getLowerBoundEdge(label); idx != wantLB {
+			t.Fatalf("getLowerBoundEdge(%d) with %d edges: %d != %d", l, len(n.edges), idx, wantLB)
+		}
+	}
+}
+
+func TestNode_AdaptiveEdges(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	n := &Node[int]{}
+	for _, l := range rnd.Perm(256) {
+		n.addEdge(edge[int]{label: byte(l), node: &Node[int]{}})
+		checkEdges(t, n)
+		n.buildIndex()
+		checkEdges(t, n)
+	}
+	n.buildIndex()
+	if n.index != nil {
+		t.Fatalf("a full node should not need an index")
+	}
+	for _, l := range rnd.Perm(256) {
+		n.delEdge(byte(l))
+		checkEdges(t, n)
+		n.buildIndex()
+		checkEdges(t, n)
+	}
+	if len(n.edges) != 0 || n.index != nil {
+		t.Fatalf("bad: %d %v", len(n.edges), n.index != nil)
+	}
+}
+
+func TestNode_AdaptiveEdgesImmutable(t *testing.T) {
+	txn := New[int]().Txn()
+	for i := 0; i < 100; i++ {
+		txn.Insert([]byte{byte(i * 2)}, i)
+	}
+	r := txn.Commit()
+	if r.root.index == nil {
+		t.Fatalf("root should be indexed")
+	}
+
+	// Changing the edges in a new transaction must not touch the index of
+	// the committed root.
+	txn = r.Txn()
+	for i := 0; i < 100; i += 2 {
+		txn.Delete([]byte{byte(i * 2)})
+	}
+	txn.Insert([]byte{1}, -1)
+	r2 := txn.Commit()
+	checkEdges(t, r.root)
+	checkEdges(t, r2.root)
+	for i := 0; i < 100; i++ {
+		if v, ok := r.Get([]byte{byte(i * 2)}); !ok || v != i {
+			t.Fatalf("bad %d: %v", i, v)
+		}
+	}
+	if r2.Len() != 51 {
+		t.Fatalf("bad len: %d", r2.Len())
+	}
+}
+
+func TestNode_AdaptiveEdgesShared(t *testing.T) {
+	txn := New[int]().Txn()
+	for i := 0; i < 100; i++ {
+		txn.Insert([]byte{byte(i * 2), 0}, i)
+	}
+	r := txn.Commit()
+
+	// Changing a child leaves the edges of the root alone, so the copy of
+	// the root shares its index.
+	r2, _, _ := r.Insert([]byte{0, 1}, -1)
+	if r2.root == r.root || r2.root.index != r.root.index {
+		t.Fatalf("index should be shared")
+	}
+
+	// Adding an edge gives the copy an index of its own.
+	r3, _, _ := r.Insert([]byte{1}, -1)
+	if r3.root.index == nil || r3.root.index == r.root.index {
+		t.Fatalf("index should not be shared")
+	}
+	checkEdges(t, r.root)
+	checkEdges(t, r3.root)
+}
+
+// checkIndexed checks that every node under n that needs an index has one.
+func checkIndexed[T any](t *testing.T, n *Node[T]) {
+	t.Helper()
+	if num := len(n.edges); num > linearEdges && num < 256 && n.index == nil {
+		t.Fatalf("node with %d edges has no index", num)
+	}
+	for _, e := range n.edges {
+		checkIndexed(t, e.node)
+	}
+}
+
+func TestTxn_AdaptiveEdgesIndexed(t *testing.T) {
+	keys := randomKeys(20000)
+	txn := New[int]().Txn()
+	for i := 0; i < 100; i++ {
+		txn.Insert([]byte{'a', byte(i * 2)}, i)
+	}
+	for i, k := range keys {
+		txn.Insert(append([]byte{'b'}, k...), i)
+	}
+	r := txn.Commit()
+	checkIndexed(t, r.root)
+
+	// Change the dense node under "a" first, and then enough other nodes
+	// that it is evicted from the writable cache.
+	txn = r.Txn()
+	txn.Insert([]byte{'a', 1}, -1)
+	for i, k := range keys {
+		txn.Insert(append([]byte{'b'}, k...), -i)
+	}
+	checkIndexed(t, txn.Commit().root)
+
+	var ops []TxnOp[int]
+	for i, k := range randomKeys(30000)[20000:] {
+		ops = append(ops, TxnOp[int]{Key: append([]byte{'c'}, k...), Val: i})
+	}
+	txn = r.Txn()
+	txn.ApplyParallel(ops, 4)
+	checkIndexed(t, txn.Commit().root)
+
+	txn = r.Txn()
+	txn.Delete([]byte{'a', 0})
+	clone := txn.Clone()
+	checkIndexed(t, txn.Root())
+	checkIndexed(t, clone.Commit().root)
+}
+
+// randomKeys returns n random 16 byte keys, so that the nodes near the
+// root have a high fanout.
+func randomKeys(n int) [][]byte {
+	rnd := rand.New(rand.NewSource(1))
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = make([]byte, 16)
+		rnd.Read(keys[i])
+	}
+	return keys
+}
+
+func BenchmarkGet_HighFanout(b *testing.B) {
+	keys := randomKeys(100000)
+	txn := New[int]().Txn()
+	for i, k := range keys {
+		txn.Insert(k, i)
+	}
+	root := txn.Commit().Root()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.Get(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkInsert_HighFanout(b *testing.B) {
+	keys := randomKeys(100000)
+	txn := New[int]().Txn()
+	for i, k := range keys {
+		txn.Insert(k, i)
+	}
+	r := txn.Commit()
+	extra := randomKeys(b.N + 100000)[100000:]
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Insert(extra[i], i)
+	}
+}
+
+func BenchmarkTxnInsert_HighFanout(b *testing.B) {
+	keys := randomKeys(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		txn := New[int]().Txn()
+		for j, k := range keys {
+			txn.Insert(k, j)
+		}
+		txn.Commit()
+	}
+}
+
+func BenchmarkSeekLowerBound_HighFanout(b *testing.B) {
+	keys := randomKeys(100000)
+	txn := New[int]().Txn()
+	for i, k := range keys {
+		txn.Insert(k, i)
+	}
+	root := txn.Commit().Root()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		iter := root.Iterator()
+		iter.SeekLowerBound(keys[i%len(keys)][:3])
+		iter.Next()
+	}
+}
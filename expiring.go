@@ -0,0 +1,235 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import "time"
+
+// expiringEntry is a value stored in an ExpiringTree along with its
+// deadline. A zero deadline means the entry never expires.
+type expiringEntry[T any] struct {
+	val      T
+	deadline time.Time
+}
+
+// expired returns true if the entry's deadline is at or before now.
+func (e expiringEntry[T]) expired(now time.Time) bool {
+	return !e.deadline.IsZero() && !e.deadline.After(now)
+}
+
+// ExpiringTree is an immutable tree whose entries may carry a deadline,
+// after which reads treat them as missing. Expired entries keep taking up
+// space until they are removed by a transaction returned from Sweep, which
+// finds them through a secondary index ordered by deadline.
+type ExpiringTree[T any] struct {
+	entries *Tree[expiringEntry[T]]
+
+	// deadlines holds a key for every entry with a deadline, made up of
+	// the encoded deadline followed by the entry's key.
+	deadlines *Tree[struct{}]
+
+	now func() time.Time
+}
+
+// NewExpiring returns an empty ExpiringTree that uses now as its clock. If
+// now is nil, time.Now is used.
+func NewExpiring[T any](now func() time.Time) *ExpiringTree[T] {
+	if now == nil {
+		now = time.Now
+	}
+	return &ExpiringTree[T]{
+		entries:   New[expiringEntry[T]](),
+		deadlines: New[struct{}](),
+		now:       now,
+	}
+}
+
+// Len returns the number of entries in the tree, including expired entries
+// that haven't been swept yet.
+func (e *ExpiringTree[T]) Len() int {
+	return e.entries.Len()
+}
+
+// Get is used to lookup a specific key, returning the value and if it was
+// found. Expired entries are not found.
+func (e *ExpiringTree[T]) Get(k []byte) (T, bool) {
+	return getUnexpired(e.entries.root, k, e.now())
+}
+
+// Deadline returns the deadline of the given key, which is zero if the key
+// never expires, and if the key was found.
+func (e *ExpiringTree[T]) Deadline(k []byte) (time.Time, bool) {
+	entry, ok := e.entries.Get(k)
+	if !ok || entry.expired(e.now()) {
+		return time.Time{}, false
+	}
+	return entry.deadline, true
+}
+
+// Walk is used to walk the unexpired entries of the tree in order.
+func (e *ExpiringTree[T]) Walk(fn WalkFn[T]) {
+	e.WalkPrefix(nil, fn)
+}
+
+// WalkPrefix is used to walk the unexpired entries under a prefix in order.
+func (e *ExpiringTree[T]) WalkPrefix(prefix []byte, fn WalkFn[T]) {
+	now := e.now()
+	e.entries.root.WalkPrefix(prefix, func(k []byte, entry expiringEntry[T]) bool {
+		if entry.expired(now) {
+			return false
+		}
+		return fn(k, entry.val)
+	})
+}
+
+// InsertWithTTL is used to add or update a key that expires after ttl. The
+// return provides the new tree, previous value and a bool indicating if an
+// unexpired value was set.
+func (e *ExpiringTree[T]) InsertWithTTL(k []byte, v T, ttl time.Duration) (*ExpiringTree[T], T, bool) {
+	txn := e.Txn()
+	old, ok := txn.InsertWithTTL(k, v, ttl)
+	return txn.Commit(), old, ok
+}
+
+// Sweep returns a transaction that deletes every entry whose deadline is at
+// or before now, in deadline order. The transaction may be extended with
+// further changes before it is committed.
+func (e *ExpiringTree[T]) Sweep(now time.Time) *ExpiringTxn[T] {
+	txn := e.Txn()
+	iter := e.deadlines.root.Iterator()
+	for dk, _, ok := iter.Next(); ok; dk, _, ok = iter.Next() {
+		if decodeDeadline(dk).After(now) {
+			break
+		}
+		k := dk[deadlineSize:]
+		txn.entries.Delete(k)
+		txn.deadlines.Delete(dk)
+	}
+	return txn
+}
+
+// ExpiringTxn is a transaction on an ExpiringTree. It keeps the entries and
+// the deadline index in step. Like Txn it is not thread safe.
+type ExpiringTxn[T any] struct {
+	entries   *Txn[expiringEntry[T]]
+	deadlines *Txn[struct{}]
+	now       func() time.Time
+}
+
+// Txn starts a new transaction that can be used to mutate the tree.
+func (e *ExpiringTree[T]) Txn() *ExpiringTxn[T] {
+	return &ExpiringTxn[T]{
+		entries:   e.entries.Txn(),
+		deadlines: e.deadlines.Txn(),
+		now:       e.now,
+	}
+}
+
+// TrackMutate can be used to toggle if mutations are tracked, see
+// Txn.TrackMutate. Only the entries are tracked, so watches obtained from
+// GetWatch fire when an entry is changed or swept, but not when it expires.
+func (t *ExpiringTxn[T]) TrackMutate(track bool) {
+	t.entries.TrackMutate(track)
+}
+
+// Get is used to lookup a specific key, returning the value and if it was
+// found. Expired entries are not found.
+func (t *ExpiringTxn[T]) Get(k []byte) (T, bool) {
+	return getUnexpired(t.entries.Root(), k, t.now())
+}
+
+// GetWatch is used to lookup a specific key, returning the watch channel,
+// value and if it was found. Expired entries are not found.
+func (t *ExpiringTxn[T]) GetWatch(k []byte) (<-chan struct{}, T, bool) {
+	watch, entry, ok := t.entries.GetWatch(k)
+	if !ok || entry.expired(t.now()) {
+		var zero T
+		return watch, zero, false
+	}
+	return watch, entry.val, true
+}
+
+// Insert is used to add or update a key that never expires. The return
+// provides the previous value and a bool indicating if an unexpired value
+// was set.
+func (t *ExpiringTxn[T]) Insert(k []byte, v T) (T, bool) {
+	return t.insert(k, expiringEntry[T]{val: v})
+}
+
+// InsertWithTTL is used to add or update a key that expires after ttl,
+// measured from the tree's clock. The return provides the previous value
+// and a bool indicating if an unexpired value was set.
+func (t *ExpiringTxn[T]) InsertWithTTL(k []byte, v T, ttl time.Duration) (T, bool) {
+	return t.insert(k, expiringEntry[T]{val: v, deadline: t.now().Add(ttl)})
+}
+
+func (t *ExpiringTxn[T]) insert(k []byte, entry expiringEntry[T]) (T, bool) {
+	old, ok := t.entries.Insert(k, entry)
+	if ok && !old.deadline.IsZero() {
+		t.deadlines.Delete(deadlineKey(old.deadline, k))
+	}
+	if !entry.deadline.IsZero() {
+		t.deadlines.Insert(deadlineKey(entry.deadline, k), struct{}{})
+	}
+	if !ok || old.expired(t.now()) {
+		var zero T
+		return zero, false
+	}
+	return old.val, true
+}
+
+// Delete is used to delete a given key. Returns the old value if any, and a
+// bool indicating if an unexpired value was set.
+func (t *ExpiringTxn[T]) Delete(k []byte) (T, bool) {
+	old, ok := t.entries.Delete(k)
+	if ok && !old.deadline.IsZero() {
+		t.deadlines.Delete(deadlineKey(old.deadline, k))
+	}
+	if !ok || old.expired(t.now()) {
+		var zero T
+		return zero, false
+	}
+	return old.val, true
+}
+
+// Commit is used to finalize the transaction and return a new tree. If
+// mutation tracking is turned on then notifications will also be issued.
+func (t *ExpiringTxn[T]) Commit() *ExpiringTree[T] {
+	return &ExpiringTree[T]{
+		entries:   t.entries.Commit(),
+		deadlines: t.deadlines.Commit(),
+		now:       t.now,
+	}
+}
+
+// getUnexpired looks up k under n, ignoring an entry that expired at now.
+func getUnexpired[T any](n *Node[expiringEntry[T]], k []byte, now time.Time) (T, bool) {
+	entry, ok := n.Get(k)
+	if !ok || entry.expired(now) {
+		var zero T
+		return zero, false
+	}
+	return entry.val, true
+}
+
+// deadlineSize is the size of an encoded deadline.
+const deadlineSize = 12
+
+// deadlineKey returns the key for k in the deadline index. Deadlines are
+// encoded with TimeKeyCodec, which sorts them in time order and, unlike
+// nanoseconds since the epoch, covers any deadline a TTL can reach.
+func deadlineKey(deadline time.Time, k []byte) []byte {
+	out := make([]byte, 0, deadlineSize+len(k))
+	out = TimeKeyCodec{}.AppendKey(out, deadline)
+	return append(out, k...)
+}
+
+// decodeDeadline returns the deadline encoded at the start of a deadline
+// index key.
+func decodeDeadline(dk []byte) time.Time {
+	deadline, err := TimeKeyCodec{}.DecodeKey(dk[:deadlineSize])
+	if err != nil {
+		panic(err)
+	}
+	return deadline
+}
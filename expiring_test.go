@@ -0,0 +1,121 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExpiringTree(t *testing.T) {
+	now := time.Unix(1000, 0)
+	e := NewExpiring[string](func() time.Time { return now })
+
+	txn := e.Txn()
+	txn.InsertWithTTL([]byte("session/a"), "a", 10*time.Second)
+	txn.InsertWithTTL([]byte("session/b"), "b", 5*time.Second)
+	txn.InsertWithTTL([]byte("session/c"), "c", 20*time.Second)
+	txn.Insert([]byte("forever"), "f")
+	e = txn.Commit()
+
+	if v, ok := e.Get([]byte("session/b")); !ok || v != "b" {
+		t.Fatalf("bad: %v", v)
+	}
+	if d, ok := e.Deadline([]byte("session/a")); !ok || !d.Equal(now.Add(10*time.Second)) {
+		t.Fatalf("bad deadline: %v", d)
+	}
+
+	// Move the clock so that b and a have expired.
+	now = now.Add(10 * time.Second)
+	if _, ok := e.Get([]byte("session/a")); ok {
+		t.Fatalf("session/a should have expired")
+	}
+	if _, ok := e.Get([]byte("session/c")); !ok {
+		t.Fatalf("session/c should not have expired")
+	}
+	var keys []string
+	e.Walk(func(k []byte, _ string) bool {
+		keys = append(keys, string(k))
+		return false
+	})
+	if !reflect.DeepEqual(keys, []string{"forever", "session/c"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+	if e.Len() != 4 {
+		t.Fatalf("expired entries should remain until swept: %d", e.Len())
+	}
+
+	// The sweep should visit the deadline index in order, deleting b
+	// before a.
+	sweep := e.Sweep(now)
+	var swept []string
+	sweep.deadlines.Root().Walk(func(k []byte, _ struct{}) bool {
+		swept = append(swept, string(k[deadlineSize:]))
+		return false
+	})
+	if !reflect.DeepEqual(swept, []string{"session/c"}) {
+		t.Fatalf("bad: %v", swept)
+	}
+	e2 := sweep.Commit()
+	if e2.Len() != 2 {
+		t.Fatalf("bad len: %d", e2.Len())
+	}
+
+	// Refreshing an entry's TTL replaces its deadline.
+	e3, old, ok := e2.InsertWithTTL([]byte("session/c"), "c2", time.Hour)
+	if !ok || old != "c" {
+		t.Fatalf("bad: %v %v", old, ok)
+	}
+	now = now.Add(time.Minute)
+	if e3.Sweep(now).Commit().Len() != 2 {
+		t.Fatalf("refreshed entry should not be swept")
+	}
+	if e3.deadlines.Len() != 1 {
+		t.Fatalf("stale deadline left behind: %d", e3.deadlines.Len())
+	}
+}
+
+func TestExpiringTxn_Delete(t *testing.T) {
+	now := time.Unix(1000, 0)
+	e := NewExpiring[int](func() time.Time { return now })
+	e, _, _ = e.InsertWithTTL([]byte("foo"), 1, time.Second)
+
+	txn := e.Txn()
+	txn.TrackMutate(true)
+	watch, v, ok := txn.GetWatch([]byte("foo"))
+	if !ok || v != 1 {
+		t.Fatalf("bad: %v", v)
+	}
+	if v, ok := txn.Delete([]byte("foo")); !ok || v != 1 {
+		t.Fatalf("bad: %v", v)
+	}
+	e = txn.Commit()
+	if e.Len() != 0 || e.deadlines.Len() != 0 {
+		t.Fatalf("bad len: %d %d", e.Len(), e.deadlines.Len())
+	}
+	select {
+	case <-watch:
+	default:
+		t.Fatalf("watch should fire")
+	}
+}
+
+func TestExpiringTree_FarDeadline(t *testing.T) {
+	now := time.Now()
+	e := NewExpiring[string](func() time.Time { return now })
+	e, _, _ = e.InsertWithTTL([]byte("far"), "far", math.MaxInt64)
+	e, _, _ = e.InsertWithTTL([]byte("near"), "near", time.Second)
+
+	// A deadline past the range of UnixNano must still sort after now.
+	now = now.Add(time.Hour)
+	e = e.Sweep(now).Commit()
+	if v, ok := e.Get([]byte("far")); !ok || v != "far" || e.Len() != 1 {
+		t.Fatalf("bad: %v %d", v, e.Len())
+	}
+	if _, ok := e.Get([]byte("near")); ok {
+		t.Fatalf("near should have been swept")
+	}
+}
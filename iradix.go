@@ -29,14 +29,21 @@ const (
 type Tree[T any] struct {
 	root *Node[T]
 	size int
+
+	// compact is set for trees whose leaves don't store their keys, see
+	// CompactKeys.
+	compact bool
 }
 
 // New returns an empty Tree
-func New[T any]() *Tree[T] {
+func New[T any](opts ...Option) *Tree[T] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
 	t := &Tree[T]{
-		root: &Node[T]{
-			mutateCh: make(chan struct{}),
-		},
+		root:    &Node[T]{},
+		compact: o.compact,
 	}
 	return t
 }
@@ -61,6 +68,9 @@ type Txn[T any] struct {
 	// transaction.
 	size int
 
+	// compact is set if the tree doesn't store the keys of its leaves.
+	compact bool
+
 	// writable is a cache of writable nodes that have been created during
 	// the course of the transaction. This allows us to re-use the same
 	// nodes for further writes and avoid unnecessary copies of nodes that
@@ -74,17 +84,41 @@ type Txn[T any] struct {
 	// trackOverflow flag, which will cause us to use a more expensive
 	// algorithm to perform the notifications. Mutation tracking is only
 	// performed if trackMutate is true.
-	trackChannels map[chan struct{}]struct{}
+	trackChannels map[*watchCh]struct{}
 	trackOverflow bool
 	trackMutate   bool
+
+	// log is the optional write-ahead log that operations are appended to,
+	// see SetLog.
+	log *txnLog[T]
+
+	// reads records what the transaction has read when read tracking is
+	// enabled, see TrackReads.
+	reads *readSet
+
+	// ops records the operations applied to the transaction when trackOps
+	// is set, so they can be replayed by Rebase.
+	ops      []txnOp[T]
+	trackOps bool
+
+	// arena is set when the transaction allocates from slabs, see
+	// UseArena.
+	arena *txnArena[T]
+
+	// parentWritable is the writable set of the transaction that started
+	// this one to apply part of a batch, see ApplyParallel. Nodes in it
+	// belong to that transaction's root and can be written in place. It is
+	// only read, while the parent waits for its workers.
+	parentWritable *simplelru.LRU[*Node[T], any]
 }
 
 // Txn starts a new transaction that can be used to mutate the tree
 func (t *Tree[T]) Txn() *Txn[T] {
 	txn := &Txn[T]{
-		root: t.root,
-		snap: t.root,
-		size: t.size,
+		root:    t.root,
+		snap:    t.root,
+		size:    t.size,
+		compact: t.compact,
 	}
 	return txn
 }
@@ -93,12 +127,16 @@ func (t *Tree[T]) Txn() *Txn[T] {
 // does not track any nodes and has TrackMutate turned off. The cloned transaction will contain any uncommitted writes in the original transaction but further mutations to either will be independent and result in different radix trees on Commit. A cloned transaction may be passed to another goroutine and mutated there independently however each transaction may only be mutated in a single thread.
 func (t *Txn[T]) Clone() *Txn[T] {
 	// reset the writable node cache to avoid leaking future writes into the clone
-	t.writable = nil
+	t.sealWritable()
 
 	txn := &Txn[T]{
-		root: t.root,
-		snap: t.snap,
-		size: t.size,
+		root:    t.root,
+		snap:    t.snap,
+		size:    t.size,
+		compact: t.compact,
+	}
+	if t.arena != nil {
+		txn.arena = &txnArena[T]{}
 	}
 	return txn
 }
@@ -114,7 +152,7 @@ func (t *Txn[T]) TrackMutate(track bool) {
 // overflow flag if we can no longer track any more. This limits the amount of
 // state that will accumulate during a transaction and we have a slower algorithm
 // to switch to if we overflow.
-func (t *Txn[T]) trackChannel(ch chan struct{}) {
+func (t *Txn[T]) trackChannel(ch *watchCh) {
 	// In overflow, make sure we don't store any more objects.
 	if t.trackOverflow {
 		return
@@ -135,13 +173,36 @@ func (t *Txn[T]) trackChannel(ch chan struct{}) {
 
 	// Create the map on the fly when we need it.
 	if t.trackChannels == nil {
-		t.trackChannels = make(map[chan struct{}]struct{})
+		t.trackChannels = make(map[*watchCh]struct{})
 	}
 
 	// Otherwise we are good to track it.
 	t.trackChannels[ch] = struct{}{}
 }
 
+// newWritable returns an empty cache of writable nodes. Nodes evicted from
+// it can no longer be changed by the transaction, so they get their index.
+func newWritable[T any]() *simplelru.LRU[*Node[T], any] {
+	lru, err := simplelru.NewLRU[*Node[T], any](defaultModifiedCache, func(n *Node[T], _ any) {
+		n.buildIndex()
+	})
+	if err != nil {
+		panic(err)
+	}
+	return lru
+}
+
+// sealWritable drops the writable cache, evicting the nodes in it so that
+// they get their index, after which the transaction copies any node it
+// changes.
+func (t *Txn[T]) sealWritable() {
+	if t.writable == nil {
+		return
+	}
+	t.writable.Purge()
+	t.writable = nil
+}
+
 // writeNode returns a node to be modified, if the current node has already been
 // modified during the course of the transaction, it is used in-place. Set
 // forLeafUpdate to true if you are getting a write node to update the leaf,
@@ -149,11 +210,7 @@ func (t *Txn[T]) trackChannel(ch chan struct{}) {
 func (t *Txn[T]) writeNode(n *Node[T], forLeafUpdate bool) *Node[T] {
 	// Ensure the writable set exists.
 	if t.writable == nil {
-		lru, err := simplelru.NewLRU[*Node[T], any](defaultModifiedCache, nil)
-		if err != nil {
-			panic(err)
-		}
-		t.writable = lru
+		t.writable = newWritable[T]()
 	}
 
 	// If this node has already been modified, we can continue to use it
@@ -161,38 +218,35 @@ func (t *Txn[T]) writeNode(n *Node[T], forLeafUpdate bool) *Node[T] {
 	// a node update since the node is writable, but if this is for a leaf
 	// update we track it, in case the initial write to this node didn't
 	// update the leaf.
-	if _, ok := t.writable.Get(n); ok {
+	if _, ok := t.writable.Get(n); ok || t.isParentWritable(n) {
 		if t.trackMutate && forLeafUpdate && n.leaf != nil {
-			t.trackChannel(n.leaf.mutateCh)
+			t.trackChannel(&n.leaf.mutateCh)
 		}
 		return n
 	}
 
 	// Mark this node as being mutated.
 	if t.trackMutate {
-		t.trackChannel(n.mutateCh)
+		t.trackChannel(&n.mutateCh)
 	}
 
 	// Mark its leaf as being mutated, if appropriate.
 	if t.trackMutate && forLeafUpdate && n.leaf != nil {
-		t.trackChannel(n.leaf.mutateCh)
+		t.trackChannel(&n.leaf.mutateCh)
 	}
 
 	// Copy the existing node. If you have set forLeafUpdate it will be
 	// safe to replace this leaf with another after you get your node for
 	// writing. You MUST replace it, because the channel associated with
 	// this leaf will be closed when this transaction is committed.
-	nc := &Node[T]{
-		mutateCh: make(chan struct{}),
-		leaf:     n.leaf,
-	}
+	nc := t.newNode()
+	nc.leaf = n.leaf
 	if n.prefix != nil {
-		nc.prefix = make([]byte, len(n.prefix))
-		copy(nc.prefix, n.prefix)
+		nc.prefix = t.copyPrefix(n.prefix)
 	}
 	if len(n.edges) != 0 {
-		nc.edges = make([]edge[T], len(n.edges))
-		copy(nc.edges, n.edges)
+		nc.edges = t.copyEdges(n.edges)
+		nc.index = n.index
 	}
 
 	// Mark this node as writable.
@@ -210,12 +264,12 @@ func (t *Txn[T]) trackChannelsAndCount(n *Node[T]) int {
 	}
 	// Mark this node as being mutated.
 	if t.trackMutate {
-		t.trackChannel(n.mutateCh)
+		t.trackChannel(&n.mutateCh)
 	}
 
 	// Mark its leaf as being mutated, if appropriate.
 	if t.trackMutate && n.leaf != nil {
-		t.trackChannel(n.leaf.mutateCh)
+		t.trackChannel(&n.leaf.mutateCh)
 	}
 
 	// Recurse on the children
@@ -234,17 +288,18 @@ func (t *Txn[T]) mergeChild(n *Node[T]) {
 	e := n.edges[0]
 	child := e.node
 	if t.trackMutate {
-		t.trackChannel(child.mutateCh)
+		t.trackChannel(&child.mutateCh)
 	}
 
 	// Merge the nodes.
 	n.prefix = concat(n.prefix, child.prefix)
 	n.leaf = child.leaf
 	if len(child.edges) != 0 {
-		n.edges = make([]edge[T], len(child.edges))
-		copy(n.edges, child.edges)
+		n.edges = t.copyEdges(child.edges)
+		n.index = child.index
 	} else {
 		n.edges = nil
+		n.index = nil
 	}
 }
 
@@ -262,11 +317,7 @@ func (t *Txn[T]) insert(n *Node[T], k, search []byte, v T) (*Node[T], T, bool) {
 		}
 
 		nc := t.writeNode(n, true)
-		nc.leaf = &leafNode[T]{
-			mutateCh: make(chan struct{}),
-			key:      k,
-			val:      v,
-		}
+		nc.leaf = t.newLeaf(k, v)
 		return nc, oldVal, didUpdate
 	}
 
@@ -277,16 +328,10 @@ func (t *Txn[T]) insert(n *Node[T], k, search []byte, v T) (*Node[T], T, bool) {
 	if child == nil {
 		e := edge[T]{
 			label: search[0],
-			node: &Node[T]{
-				mutateCh: make(chan struct{}),
-				leaf: &leafNode[T]{
-					mutateCh: make(chan struct{}),
-					key:      k,
-					val:      v,
-				},
-				prefix: search,
-			},
+			node:  t.newNode(),
 		}
+		e.node.leaf = t.newLeaf(k, v)
+		e.node.prefix = t.ownPrefix(search)
 		nc := t.writeNode(n, false)
 		nc.addEdge(e)
 		return nc, zero, false
@@ -307,10 +352,8 @@ func (t *Txn[T]) insert(n *Node[T], k, search []byte, v T) (*Node[T], T, bool) {
 
 	// Split the node
 	nc := t.writeNode(n, false)
-	splitNode := &Node[T]{
-		mutateCh: make(chan struct{}),
-		prefix:   search[:commonPrefix],
-	}
+	splitNode := t.newNode()
+	splitNode.prefix = t.ownPrefix(search[:commonPrefix])
 	nc.replaceEdge(edge[T]{
 		label: search[0],
 		node:  splitNode,
@@ -325,11 +368,7 @@ func (t *Txn[T]) insert(n *Node[T], k, search []byte, v T) (*Node[T], T, bool) {
 	modChild.prefix = modChild.prefix[commonPrefix:]
 
 	// Create a new leaf node
-	leaf := &leafNode[T]{
-		mutateCh: make(chan struct{}),
-		key:      k,
-		val:      v,
-	}
+	leaf := t.newLeaf(k, v)
 
 	// If the new key is a subset, add to to this node
 	search = search[commonPrefix:]
@@ -339,13 +378,12 @@ func (t *Txn[T]) insert(n *Node[T], k, search []byte, v T) (*Node[T], T, bool) {
 	}
 
 	// Create a new edge for the node
+	leafParent := t.newNode()
+	leafParent.leaf = leaf
+	leafParent.prefix = t.ownPrefix(search)
 	splitNode.addEdge(edge[T]{
 		label: search[0],
-		node: &Node[T]{
-			mutateCh: make(chan struct{}),
-			leaf:     leaf,
-			prefix:   search,
-		},
+		node:  leafParent,
 	})
 	return nc, zero, false
 }
@@ -415,6 +453,7 @@ func (t *Txn[T]) deletePrefix(n *Node[T], search []byte) (*Node[T], int) {
 			nc.leaf = nil
 		}
 		nc.edges = nil
+		nc.index = nil
 		return nc, t.trackChannelsAndCount(n)
 	}
 
@@ -457,8 +496,10 @@ func (t *Txn[T]) deletePrefix(n *Node[T], search []byte) (*Node[T], int) {
 }
 
 // Insert is used to add or update a given key. The return provides
-// the previous value and a bool indicating if any was set.
+// the previous value and a bool indicating if any was set. The key is
+// copied, so the caller may reuse it afterwards.
 func (t *Txn[T]) Insert(k []byte, v T) (T, bool) {
+	k = t.ownKey(k)
 	newRoot, oldVal, didUpdate := t.insert(t.root, k, k, v)
 	if newRoot != nil {
 		t.root = newRoot
@@ -466,6 +507,12 @@ func (t *Txn[T]) Insert(k []byte, v T) (T, bool) {
 	if !didUpdate {
 		t.size++
 	}
+	if t.log != nil {
+		t.log.insert(k, v)
+	}
+	if t.trackOps {
+		t.ops = append(t.ops, txnOp[T]{kind: walInsert, key: k, val: v})
+	}
 	return oldVal, didUpdate
 }
 
@@ -477,8 +524,14 @@ func (t *Txn[T]) Delete(k []byte) (T, bool) {
 	if newRoot != nil {
 		t.root = newRoot
 	}
+	if t.trackOps {
+		t.ops = append(t.ops, txnOp[T]{kind: walDelete, key: append([]byte(nil), k...)})
+	}
 	if leaf != nil {
 		t.size--
+		if t.log != nil {
+			t.log.write(walDelete, k, nil)
+		}
 		return leaf.val, true
 	}
 	return zero, false
@@ -487,10 +540,20 @@ func (t *Txn[T]) Delete(k []byte) (T, bool) {
 // DeletePrefix is used to delete an entire subtree that matches the prefix
 // This will delete all nodes under that prefix
 func (t *Txn[T]) DeletePrefix(prefix []byte) bool {
+	// The result depends on every key under the prefix.
+	if t.reads != nil {
+		t.reads.addPrefix(prefix)
+	}
 	newRoot, numDeletions := t.deletePrefix(t.root, prefix)
+	if t.trackOps {
+		t.ops = append(t.ops, txnOp[T]{kind: walDeletePrefix, key: append([]byte(nil), prefix...)})
+	}
 	if newRoot != nil {
 		t.root = newRoot
 		t.size = t.size - numDeletions
+		if t.log != nil {
+			t.log.write(walDeletePrefix, prefix, nil)
+		}
 		return true
 	}
 	return false
@@ -507,15 +570,53 @@ func (t *Txn[T]) Root() *Node[T] {
 // Get is used to lookup a specific key, returning
 // the value and if it was found
 func (t *Txn[T]) Get(k []byte) (T, bool) {
+	if t.reads != nil {
+		t.reads.addKey(k)
+	}
 	return t.root.Get(k)
 }
 
 // GetWatch is used to lookup a specific key, returning
 // the watch channel, value and if it was found
 func (t *Txn[T]) GetWatch(k []byte) (<-chan struct{}, T, bool) {
+	if t.reads != nil {
+		t.reads.addKey(k)
+	}
 	return t.root.GetWatch(k)
 }
 
+// LongestPrefix is like Get, but instead of an
+// exact match, it will return the longest prefix match.
+func (t *Txn[T]) LongestPrefix(k []byte) ([]byte, T, bool) {
+	if t.reads != nil {
+		t.reads.addPath(k)
+	}
+	return t.root.LongestPrefix(k)
+}
+
+// Iterator returns an iterator over the current state of the transaction.
+// Like Root, the iterator is not safe across insert and delete operations.
+func (t *Txn[T]) Iterator() *Iterator[T] {
+	iter := t.root.Iterator()
+	if t.reads != nil {
+		iter.reads = t.reads
+		iter.rng = t.reads.addRange(nil, nil, false)
+	}
+	return iter
+}
+
+// ReverseIterator returns a reverse iterator over the current state of the
+// transaction. Like Root, the iterator is not safe across insert and delete
+// operations.
+func (t *Txn[T]) ReverseIterator() *ReverseIterator[T] {
+	iter := t.root.ReverseIterator()
+	if t.reads != nil {
+		iter.i.reads = t.reads
+		iter.rng = t.reads.addRange(nil, nil, true)
+	}
+	return iter
+}
+
 // Commit is used to finalize the transaction and return a new tree. If mutation
 // tracking is turned on then notifications will also be issued.
 func (t *Txn[T]) Commit() *Tree[T] {
@@ -529,8 +630,11 @@ func (t *Txn[T]) Commit() *Tree[T] {
 // CommitOnly is used to finalize the transaction and return a new tree, but
 // does not issue any notifications until Notify is called.
 func (t *Txn[T]) CommitOnly() *Tree[T] {
-	nt := &Tree[T]{t.root, t.size}
-	t.writable = nil
+	nt := &Tree[T]{t.root, t.size, t.compact}
+	t.sealWritable()
+	if t.log != nil {
+		t.log.commit()
+	}
 	return nt
 }
 
@@ -553,9 +657,9 @@ func (t *Txn[T]) slowNotify() {
 		// know from the loop condition there's something in the old
 		// snapshot.
 		if rootIter.Front() == nil {
-			close(snapElem.mutateCh)
+			snapElem.mutateCh.notify()
 			if snapElem.isLeaf() {
-				close(snapElem.leaf.mutateCh)
+				snapElem.leaf.mutateCh.notify()
 			}
 			snapIter.Next()
 			continue
@@ -568,9 +672,9 @@ func (t *Txn[T]) slowNotify() {
 		// If the snapshot is behind the root, then we must have deleted
 		// this node during the transaction.
 		if cmp < 0 {
-			close(snapElem.mutateCh)
+			snapElem.mutateCh.notify()
 			if snapElem.isLeaf() {
-				close(snapElem.leaf.mutateCh)
+				snapElem.leaf.mutateCh.notify()
 			}
 			snapIter.Next()
 			continue
@@ -587,9 +691,9 @@ func (t *Txn[T]) slowNotify() {
 		// node and possibly the leaf.
 		rootElem := rootIter.Front()
 		if snapElem != rootElem {
-			close(snapElem.mutateCh)
+			snapElem.mutateCh.notify()
 			if snapElem.leaf != nil && (snapElem.leaf != rootElem.leaf) {
-				close(snapElem.leaf.mutateCh)
+				snapElem.leaf.mutateCh.notify()
 			}
 		}
 		snapIter.Next()
@@ -611,7 +715,7 @@ func (t *Txn[T]) Notify() {
 		t.slowNotify()
 	} else {
 		for ch := range t.trackChannels {
-			close(ch)
+			ch.notify()
 		}
 	}
 
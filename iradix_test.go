@@ -17,17 +17,16 @@ import (
 
 func CopyTree[T any](t *Tree[T]) *Tree[T] {
 	nt := &Tree[T]{
-		root: CopyNode(t.root),
-		size: t.size,
+		root:    CopyNode(t.root),
+		size:    t.size,
+		compact: t.compact,
 	}
 	return nt
 }
 
 func CopyNode[T any](n *Node[T]) *Node[T] {
 	nn := new(Node[T])
-	if n.mutateCh != nil {
-		nn.mutateCh = n.mutateCh
-	}
+	nn.mutateCh = n.mutateCh
 	if n.prefix != nil {
 		nn.prefix = make([]byte, len(n.prefix))
 		copy(nn.prefix, n.prefix)
@@ -844,10 +843,10 @@ func isClosed(ch chan struct{}) bool {
 func hasAnyClosedMutateCh[T any](r *Tree[T]) bool {
 	for iter := r.root.rawIterator(); iter.Front() != nil; iter.Next() {
 		n := iter.Front()
-		if isClosed(n.mutateCh) {
+		if isClosed(n.mutateCh.load()) {
 			return true
 		}
-		if n.isLeaf() && isClosed(n.leaf.mutateCh) {
+		if n.isLeaf() && isClosed(n.leaf.mutateCh.load()) {
 			return true
 		}
 	}
@@ -1411,19 +1410,19 @@ func TestTrackMutate_mergeChild(t *testing.T) {
 			path := snapIter.Path()
 			switch path {
 			case "", "a", "ac": // parent nodes all change
-				if !isClosed(n.mutateCh) || n.leaf != nil {
+				if !isClosed(n.mutateCh.load()) || n.leaf != nil {
 					t.Fatalf("bad")
 				}
 			case "ab": // unrelated node / leaf sees no change
-				if isClosed(n.mutateCh) || isClosed(n.leaf.mutateCh) {
+				if isClosed(n.mutateCh.load()) || isClosed(n.leaf.mutateCh.load()) {
 					t.Fatalf("bad")
 				}
 			case "aca": // this node gets merged, but the leaf doesn't change
-				if !isClosed(n.mutateCh) || isClosed(n.leaf.mutateCh) {
+				if !isClosed(n.mutateCh.load()) || isClosed(n.leaf.mutateCh.load()) {
 					t.Fatalf("bad")
 				}
 			case "acb": // this node / leaf gets deleted
-				if !isClosed(n.mutateCh) || !isClosed(n.leaf.mutateCh) {
+				if !isClosed(n.mutateCh.load()) || !isClosed(n.leaf.mutateCh.load()) {
 					t.Fatalf("bad")
 				}
 			default:
@@ -1479,19 +1478,19 @@ func TestTrackMutate_cachedNodeChange(t *testing.T) {
 			path := snapIter.Path()
 			switch path {
 			case "", "a", "ac": // parent nodes all change
-				if !isClosed(n.mutateCh) || n.leaf != nil {
+				if !isClosed(n.mutateCh.load()) || n.leaf != nil {
 					t.Fatalf("bad")
 				}
 			case "ab": // unrelated node / leaf sees no change
-				if isClosed(n.mutateCh) || isClosed(n.leaf.mutateCh) {
+				if isClosed(n.mutateCh.load()) || isClosed(n.leaf.mutateCh.load()) {
 					t.Fatalf("bad")
 				}
 			case "aca": // merge changes the node, then we update the leaf
-				if !isClosed(n.mutateCh) || !isClosed(n.leaf.mutateCh) {
+				if !isClosed(n.mutateCh.load()) || !isClosed(n.leaf.mutateCh.load()) {
 					t.Fatalf("bad")
 				}
 			case "acb": // this node / leaf gets deleted
-				if !isClosed(n.mutateCh) || !isClosed(n.leaf.mutateCh) {
+				if !isClosed(n.mutateCh.load()) || !isClosed(n.leaf.mutateCh.load()) {
 					t.Fatalf("bad")
 				}
 			default:
@@ -12,20 +12,45 @@ import (
 type Iterator[T any] struct {
 	node  *Node[T]
 	stack []edges[T]
+
+	// For compact trees, depths holds the length of the path to the parent
+	// of the edges at the same position in stack, and path holds the path to
+	// the node visited last, which keys are rebuilt from.
+	depths  []int
+	path    []byte
+	compact bool
+
+	// reads is set when the iterator belongs to a transaction that is
+	// tracking reads, and rng is the range currently being read.
+	reads *readSet
+	rng   *readRange
 }
 
 // SeekPrefixWatch is used to seek the iterator to a given prefix
 // and returns the watch channel of the finest granularity
 func (i *Iterator[T]) SeekPrefixWatch(prefix []byte) (watch <-chan struct{}) {
+	return i.seekPrefix(prefix).get()
+}
+
+// seekPrefix is like SeekPrefixWatch, but returns the watch channel without
+// making it.
+func (i *Iterator[T]) seekPrefix(prefix []byte) (watch *watchCh) {
 	// Wipe the stack
 	i.stack = nil
+	i.depths = nil
+	if i.reads != nil {
+		i.reads.addPrefix(prefix)
+		i.rng = nil
+	}
 	n := i.node
-	watch = n.mutateCh
+	watch = &n.mutateCh
 	search := prefix
+	depth := 0
 	for {
 		// Check for key exhaustion
 		if len(search) == 0 {
 			i.node = n
+			i.setPath(prefix[:depth])
 			return
 		}
 
@@ -37,7 +62,8 @@ func (i *Iterator[T]) SeekPrefixWatch(prefix []byte) (watch <-chan struct{}) {
 		}
 
 		// Update to the finest granularity as the search makes progress
-		watch = n.mutateCh
+		watch = &n.mutateCh
+		depth = len(prefix) - len(search)
 
 		// Consume the search prefix
 		if bytes.HasPrefix(search, n.prefix) {
@@ -45,6 +71,7 @@ func (i *Iterator[T]) SeekPrefixWatch(prefix []byte) (watch <-chan struct{}) {
 
 		} else if bytes.HasPrefix(n.prefix, search) {
 			i.node = n
+			i.setPath(prefix[:depth])
 			return
 		} else {
 			i.node = nil
@@ -55,25 +82,75 @@ func (i *Iterator[T]) SeekPrefixWatch(prefix []byte) (watch <-chan struct{}) {
 
 // SeekPrefix is used to seek the iterator to a given prefix
 func (i *Iterator[T]) SeekPrefix(prefix []byte) {
-	i.SeekPrefixWatch(prefix)
+	i.seekPrefix(prefix)
+}
+
+// setPath sets the path for compact trees to a copy of p.
+func (i *Iterator[T]) setPath(p []byte) {
+	if i.compact {
+		i.path = append(i.path[:0], p...)
+	}
+}
+
+// push adds edges to the stack, given the length of the path to their
+// parent.
+func (i *Iterator[T]) push(e edges[T], depth int) {
+	i.stack = append(i.stack, e)
+	if i.compact {
+		i.depths = append(i.depths, depth)
+	}
+}
+
+// pop removes the top entry of the stack, returning the length of the path
+// to the parent of its edges.
+func (i *Iterator[T]) pop() int {
+	n := len(i.stack)
+	i.stack = i.stack[:n-1]
+	if !i.compact {
+		return 0
+	}
+	depth := i.depths[n-1]
+	i.depths = i.depths[:n-1]
+	return depth
+}
+
+// depth returns the length of the path to the parent of the edges at the
+// top of the stack.
+func (i *Iterator[T]) depth() int {
+	if !i.compact {
+		return 0
+	}
+	return i.depths[len(i.depths)-1]
+}
+
+// visit updates the path for compact trees to lead to n, given the length
+// of the path to its parent, and returns the length of the path to n.
+func (i *Iterator[T]) visit(n *Node[T], depth int) int {
+	if i.compact {
+		i.path = append(i.path[:depth], n.prefix...)
+	}
+	return depth + len(n.prefix)
 }
 
-func (i *Iterator[T]) recurseMin(n *Node[T]) *Node[T] {
+// recurseMin returns the minimum leaf node under n along with the length of
+// the path to its parent, given the length of the path to the parent of n.
+func (i *Iterator[T]) recurseMin(n *Node[T], depth int) (*Node[T], int) {
 	// Traverse to the minimum child
 	if n.leaf != nil {
-		return n
+		return n, depth
 	}
+	through := i.visit(n, depth)
 	nEdges := len(n.edges)
 	if nEdges > 1 {
 		// Add all the other edges to the stack (the min node will be added as
 		// we recurse)
-		i.stack = append(i.stack, n.edges[1:])
+		i.push(n.edges[1:], through)
 	}
 	if nEdges > 0 {
-		return i.recurseMin(n.edges[0].node)
+		return i.recurseMin(n.edges[0].node, through)
 	}
 	// Shouldn't be possible
-	return nil
+	return nil, 0
 }
 
 // SeekLowerBound is used to seek the iterator to the smallest key that is
@@ -87,6 +164,10 @@ func (i *Iterator[T]) SeekLowerBound(key []byte) {
 	// children that we don't traverse on the way to the reverse lower bound as it
 	// walks the stack.
 	i.stack = []edges[T]{}
+	i.depths = nil
+	if i.reads != nil {
+		i.rng = i.reads.addRange(key, nil, false)
+	}
 	// i.node starts off in the common case as pointing to the root node of the
 	// tree. By the time we return we have either found a lower bound and setup
 	// the stack to traverse all larger keys, or we have not and the stack and
@@ -97,22 +178,26 @@ func (i *Iterator[T]) SeekLowerBound(key []byte) {
 	i.node = nil
 	search := key
 
-	found := func(n *Node[T]) {
-		i.stack = append(
-			i.stack,
-			edges[T]{edge[T]{node: n}},
-		)
+	// The search follows the key, so for compact trees the path to every
+	// node on the way is a prefix of the key.
+	i.setPath(key)
+
+	found := func(n *Node[T], depth int) {
+		i.push(edges[T]{edge[T]{node: n}}, depth)
 	}
 
-	findMin := func(n *Node[T]) {
-		n = i.recurseMin(n)
+	findMin := func(n *Node[T], depth int) {
+		n, depth = i.recurseMin(n, depth)
 		if n != nil {
-			found(n)
+			found(n, depth)
 			return
 		}
 	}
 
 	for {
+		// The length of the path to the parent of n.
+		depth := len(key) - len(search)
+
 		// Compare current prefix with the search key's same-length prefix.
 		var prefixCmp int
 		if len(n.prefix) < len(search) {
@@ -125,7 +210,7 @@ func (i *Iterator[T]) SeekLowerBound(key []byte) {
 			// Prefix is larger, that means the lower bound is greater than the search
 			// and from now on we need to follow the minimum path to the smallest
 			// leaf under this subtree.
-			findMin(n)
+			findMin(n, depth)
 			return
 		}
 
@@ -137,9 +222,10 @@ func (i *Iterator[T]) SeekLowerBound(key []byte) {
 		}
 
 		// Prefix is equal, we are still heading for an exact match. If this is a
-		// leaf and an exact match we're done.
-		if n.leaf != nil && bytes.Equal(n.leaf.key, key) {
-			found(n)
+		// leaf and an exact match, meaning the prefix is the rest of the search
+		// key, we're done.
+		if n.leaf != nil && len(n.prefix) == len(search) {
+			found(n, depth)
 			return
 		}
 
@@ -153,7 +239,7 @@ func (i *Iterator[T]) SeekLowerBound(key []byte) {
 			// match or not a leaf. That means that the leaf value if it exists, and
 			// all child nodes must be strictly greater, the smallest key in this
 			// subtree must be the lower bound.
-			findMin(n)
+			findMin(n, depth)
 			return
 		}
 
@@ -165,7 +251,7 @@ func (i *Iterator[T]) SeekLowerBound(key []byte) {
 
 		// Create stack edges for the all strictly higher edges in this node.
 		if idx+1 < len(n.edges) {
-			i.stack = append(i.stack, n.edges[idx+1:])
+			i.push(n.edges[idx+1:], len(key)-len(search))
 		}
 
 		// Recurse
@@ -178,7 +264,7 @@ func (i *Iterator[T]) Next() ([]byte, T, bool) {
 	var zero T
 	// Initialize our stack if needed
 	if i.stack == nil && i.node != nil {
-		i.stack = []edges[T]{{edge[T]{node: i.node}}}
+		i.push(edges[T]{edge[T]{node: i.node}}, len(i.path))
 	}
 
 	for len(i.stack) > 0 {
@@ -186,23 +272,32 @@ func (i *Iterator[T]) Next() ([]byte, T, bool) {
 		n := len(i.stack)
 		last := i.stack[n-1]
 		elem := last[0].node
+		depth := i.depth()
 
 		// Update the stack
 		if len(last) > 1 {
 			i.stack[n-1] = last[1:]
 		} else {
-			i.stack = i.stack[:n-1]
+			i.pop()
 		}
 
 		// Push the edges onto the frontier
+		through := i.visit(elem, depth)
 		if len(elem.edges) > 0 {
-			i.stack = append(i.stack, elem.edges)
+			i.push(elem.edges, through)
 		}
 
 		// Return the leaf values if any
 		if elem.leaf != nil {
-			return elem.leaf.key, elem.leaf.val, true
+			key := elem.leaf.keyAt(i.path)
+			if i.rng != nil {
+				i.rng.hi, i.rng.read = key, true
+			}
+			return key, elem.leaf.val, true
 		}
 	}
+	if i.rng != nil {
+		i.rng.hiOpen, i.rng.read = true, true
+	}
 	return nil, zero, false
 }
@@ -0,0 +1,298 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"golang.org/x/exp/constraints"
+)
+
+// ErrInvalidKey is returned when an encoded key can't be decoded by a
+// KeyCodec.
+var ErrInvalidKey = errors.New("iradix: invalid encoded key")
+
+// KeyCodec is used to convert keys of type K to and from bytes, such that
+// the byte-wise order of encoded keys matches the natural order of K. This
+// lets a TypedTree keep its keys in a useful order and answer range queries
+// with them.
+type KeyCodec[K any] interface {
+	// AppendKey appends the encoding of k to dst and returns the result.
+	AppendKey(dst []byte, k K) []byte
+
+	// DecodeKey decodes a whole encoded key.
+	DecodeKey(b []byte) (K, error)
+}
+
+// FixedKeyCodec is a KeyCodec whose encodings all have the same size, which
+// allows it to be used in front of other keys in a tuple.
+type FixedKeyCodec[K any] interface {
+	KeyCodec[K]
+
+	// KeySize returns the size of every encoded key.
+	KeySize() int
+}
+
+// StringKeyCodec encodes strings as their bytes, which sort in byte-wise
+// lexical order.
+type StringKeyCodec struct{}
+
+func (StringKeyCodec) AppendKey(dst []byte, k string) []byte {
+	return append(dst, k...)
+}
+
+func (StringKeyCodec) DecodeKey(b []byte) (string, error) {
+	return string(b), nil
+}
+
+// IntKeyCodec encodes signed integers of any width as 8 big-endian bytes
+// with the sign bit flipped, so that negative numbers sort before positive
+// ones.
+type IntKeyCodec[K constraints.Signed] struct{}
+
+func (IntKeyCodec[K]) KeySize() int { return 8 }
+
+func (IntKeyCodec[K]) AppendKey(dst []byte, k K) []byte {
+	return appendUint64(dst, uint64(int64(k))^(1<<63))
+}
+
+func (IntKeyCodec[K]) DecodeKey(b []byte) (K, error) {
+	if len(b) != 8 {
+		return 0, ErrInvalidKey
+	}
+	v := int64(binary.BigEndian.Uint64(b) ^ (1 << 63))
+	if int64(K(v)) != v {
+		return 0, ErrInvalidKey
+	}
+	return K(v), nil
+}
+
+// UintKeyCodec encodes unsigned integers of any width as 8 big-endian
+// bytes.
+type UintKeyCodec[K constraints.Unsigned] struct{}
+
+func (UintKeyCodec[K]) KeySize() int { return 8 }
+
+func (UintKeyCodec[K]) AppendKey(dst []byte, k K) []byte {
+	return appendUint64(dst, uint64(k))
+}
+
+func (UintKeyCodec[K]) DecodeKey(b []byte) (K, error) {
+	if len(b) != 8 {
+		return 0, ErrInvalidKey
+	}
+	v := binary.BigEndian.Uint64(b)
+	if uint64(K(v)) != v {
+		return 0, ErrInvalidKey
+	}
+	return K(v), nil
+}
+
+// Float64KeyCodec encodes float64 values as 8 big-endian bytes that sort in
+// numeric order, with -0 just before +0. NaNs sort after +Inf, or before
+// -Inf if their sign bit is set.
+type Float64KeyCodec struct{}
+
+func (Float64KeyCodec) KeySize() int { return 8 }
+
+func (Float64KeyCodec) AppendKey(dst []byte, k float64) []byte {
+	bits := math.Float64bits(k)
+	if bits&(1<<63) != 0 {
+		// Negative numbers sort in reverse order of their magnitude.
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return appendUint64(dst, bits)
+}
+
+func (Float64KeyCodec) DecodeKey(b []byte) (float64, error) {
+	if len(b) != 8 {
+		return 0, ErrInvalidKey
+	}
+	bits := binary.BigEndian.Uint64(b)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits), nil
+}
+
+// TimeKeyCodec encodes times as 12 bytes that sort in time order: the Unix
+// seconds in the same form as IntKeyCodec, followed by the big-endian
+// nanoseconds. Decoded times are in UTC, and the location and monotonic
+// clock reading are lost.
+type TimeKeyCodec struct{}
+
+func (TimeKeyCodec) KeySize() int { return 12 }
+
+func (TimeKeyCodec) AppendKey(dst []byte, k time.Time) []byte {
+	dst = appendUint64(dst, uint64(k.Unix())^(1<<63))
+	return appendUint32(dst, uint32(k.Nanosecond()))
+}
+
+func (TimeKeyCodec) DecodeKey(b []byte) (time.Time, error) {
+	if len(b) != 12 {
+		return time.Time{}, ErrInvalidKey
+	}
+	sec := int64(binary.BigEndian.Uint64(b) ^ (1 << 63))
+	nsec := binary.BigEndian.Uint32(b[8:])
+	if nsec >= 1e9 {
+		return time.Time{}, ErrInvalidKey
+	}
+	return time.Unix(sec, int64(nsec)).UTC(), nil
+}
+
+// Bytes16KeyCodec encodes 16 byte arrays, such as UUIDs, as themselves.
+type Bytes16KeyCodec struct{}
+
+func (Bytes16KeyCodec) KeySize() int { return 16 }
+
+func (Bytes16KeyCodec) AppendKey(dst []byte, k [16]byte) []byte {
+	return append(dst, k[:]...)
+}
+
+func (Bytes16KeyCodec) DecodeKey(b []byte) ([16]byte, error) {
+	var out [16]byte
+	if len(b) != 16 {
+		return out, ErrInvalidKey
+	}
+	copy(out[:], b)
+	return out, nil
+}
+
+// Tuple2 is a key made of two parts, ordered by the first part and then the
+// second.
+type Tuple2[A, B any] struct {
+	K1 A
+	K2 B
+}
+
+// Tuple2KeyCodec encodes a Tuple2 as its parts one after the other. The
+// first part must have a fixed size so that the parts can be told apart,
+// while the last part may be of any size.
+type Tuple2KeyCodec[A, B any] struct {
+	First  FixedKeyCodec[A]
+	Second KeyCodec[B]
+}
+
+func (c Tuple2KeyCodec[A, B]) AppendKey(dst []byte, k Tuple2[A, B]) []byte {
+	dst = c.First.AppendKey(dst, k.K1)
+	return c.Second.AppendKey(dst, k.K2)
+}
+
+func (c Tuple2KeyCodec[A, B]) DecodeKey(b []byte) (Tuple2[A, B], error) {
+	var out Tuple2[A, B]
+	n := c.First.KeySize()
+	if len(b) < n {
+		return out, ErrInvalidKey
+	}
+	var err error
+	if out.K1, err = c.First.DecodeKey(b[:n]); err != nil {
+		return out, err
+	}
+	if out.K2, err = c.Second.DecodeKey(b[n:]); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// Tuple3 is a key made of three parts, ordered by each part in turn.
+type Tuple3[A, B, C any] struct {
+	K1 A
+	K2 B
+	K3 C
+}
+
+// Tuple3KeyCodec encodes a Tuple3 as its parts one after the other. The
+// first two parts must have a fixed size, while the last part may be of any
+// size.
+type Tuple3KeyCodec[A, B, C any] struct {
+	First  FixedKeyCodec[A]
+	Second FixedKeyCodec[B]
+	Third  KeyCodec[C]
+}
+
+func (c Tuple3KeyCodec[A, B, C]) AppendKey(dst []byte, k Tuple3[A, B, C]) []byte {
+	dst = c.First.AppendKey(dst, k.K1)
+	dst = c.Second.AppendKey(dst, k.K2)
+	return c.Third.AppendKey(dst, k.K3)
+}
+
+func (c Tuple3KeyCodec[A, B, C]) DecodeKey(b []byte) (Tuple3[A, B, C], error) {
+	var out Tuple3[A, B, C]
+	n1, n2 := c.First.KeySize(), c.Second.KeySize()
+	if len(b) < n1+n2 {
+		return out, ErrInvalidKey
+	}
+	var err error
+	if out.K1, err = c.First.DecodeKey(b[:n1]); err != nil {
+		return out, err
+	}
+	if out.K2, err = c.Second.DecodeKey(b[n1 : n1+n2]); err != nil {
+		return out, err
+	}
+	if out.K3, err = c.Third.DecodeKey(b[n1+n2:]); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+// escapeKey escapes k so that no escaped key is a prefix of another, while
+// keeping their order. This allows other data to be put after the escaped
+// key in an index. Zero bytes are written as 0x00 0xff and the key is
+// terminated by 0x00 0x01.
+func escapeKey(k []byte) []byte {
+	out := make([]byte, 0, len(k)+2+8)
+	for _, b := range k {
+		out = append(out, b)
+		if b == 0 {
+			out = append(out, 0xff)
+		}
+	}
+	return append(out, 0x00, 0x01)
+}
+
+// unescapeKey reverses escapeKey on the start of ek, returning the key and
+// the rest of ek after its terminator.
+func unescapeKey(ek []byte) ([]byte, []byte, bool) {
+	out := make([]byte, 0, len(ek))
+	for i := 0; i < len(ek); i++ {
+		if ek[i] != 0 {
+			out = append(out, ek[i])
+			continue
+		}
+		if i+1 == len(ek) {
+			break
+		}
+		switch ek[i+1] {
+		case 0xff:
+			out = append(out, 0)
+			i++
+		case 0x01:
+			return out, ek[i+2:], true
+		default:
+			return nil, nil, false
+		}
+	}
+	return nil, nil, false
+}
+
+// appendUint64 appends v to dst in big-endian order.
+func appendUint64(dst []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(dst, buf[:]...)
+}
+
+// appendUint32 appends v to dst in big-endian order.
+func appendUint32(dst []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(dst, buf[:]...)
+}
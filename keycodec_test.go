@@ -0,0 +1,77 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+// checkKeyOrder checks that keys, which must be in ascending order, encode
+// to ascending bytes and decode back to themselves.
+func checkKeyOrder[K comparable](t *testing.T, codec KeyCodec[K], keys []K) {
+	t.Helper()
+	var prev []byte
+	for i, k := range keys {
+		enc := codec.AppendKey(nil, k)
+		if i > 0 && bytes.Compare(prev, enc) >= 0 {
+			t.Fatalf("bad order at %v: %x >= %x", k, prev, enc)
+		}
+		dec, err := codec.DecodeKey(enc)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if dec != k {
+			t.Fatalf("bad round trip: %v != %v", dec, k)
+		}
+		prev = enc
+	}
+}
+
+func TestKeyCodec_Order(t *testing.T) {
+	checkKeyOrder[string](t, StringKeyCodec{}, []string{"", "a", "ab", "b"})
+	checkKeyOrder[int64](t, IntKeyCodec[int64]{}, []int64{math.MinInt64, -256, -1, 0, 1, 255, math.MaxInt64})
+	checkKeyOrder[int8](t, IntKeyCodec[int8]{}, []int8{-128, -1, 0, 127})
+	checkKeyOrder[uint32](t, UintKeyCodec[uint32]{}, []uint32{0, 1, 256, math.MaxUint32})
+	checkKeyOrder[float64](t, Float64KeyCodec{}, []float64{
+		math.Inf(-1), -math.MaxFloat64, -1.5, -math.SmallestNonzeroFloat64,
+		0, math.SmallestNonzeroFloat64, 1, 1.5, math.MaxFloat64, math.Inf(1),
+	})
+	checkKeyOrder[time.Time](t, TimeKeyCodec{}, []time.Time{
+		time.Date(1066, 10, 14, 0, 0, 0, 0, time.UTC),
+		time.Unix(-1, 999999999).UTC(),
+		time.Unix(0, 0).UTC(),
+		time.Unix(0, 1).UTC(),
+		time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	checkKeyOrder[[16]byte](t, Bytes16KeyCodec{}, [][16]byte{{0}, {0, 1}, {1}, {255}})
+
+	tuple := Tuple3KeyCodec[int64, uint8, string]{
+		First:  IntKeyCodec[int64]{},
+		Second: UintKeyCodec[uint8]{},
+		Third:  StringKeyCodec{},
+	}
+	checkKeyOrder[Tuple3[int64, uint8, string]](t, tuple, []Tuple3[int64, uint8, string]{
+		{-1, 5, "z"}, {0, 0, ""}, {0, 0, "a"}, {0, 1, ""}, {1, 0, ""},
+	})
+}
+
+func TestKeyCodec_Invalid(t *testing.T) {
+	if _, err := (IntKeyCodec[int64]{}).DecodeKey([]byte{1}); err != ErrInvalidKey {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// A value that doesn't fit the narrower type.
+	enc := UintKeyCodec[uint64]{}.AppendKey(nil, 300)
+	if _, err := (UintKeyCodec[uint8]{}).DecodeKey(enc); err != ErrInvalidKey {
+		t.Fatalf("bad: %v", err)
+	}
+
+	tuple := Tuple2KeyCodec[[16]byte, string]{First: Bytes16KeyCodec{}, Second: StringKeyCodec{}}
+	if _, err := tuple.DecodeKey([]byte("short")); err != ErrInvalidKey {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrMergeConflict is returned by Merge3 when both sides changed the same
+// key and no resolve function was given.
+var ErrMergeConflict = errors.New("iradix: conflicting changes to key")
+
+// MergeValue is the value of a key on one side of a three-way merge. Found
+// is false if the key doesn't exist on that side.
+type MergeValue[T any] struct {
+	Val   T
+	Found bool
+}
+
+// MergeFn is called by Merge3 for a key that was changed on both sides. It
+// returns the value to keep, or false to delete the key.
+type MergeFn[T any] func(k []byte, base, ours, theirs MergeValue[T]) (T, bool)
+
+// Merge3 combines two trees that were both derived from base, for example
+// by transactions split off with Txn.Clone. Keys changed on only one side
+// take that side's change. Keys changed on both sides are passed to resolve,
+// unless both sides deleted them. Subtrees that one side shares with base
+// are skipped without being visited, so the cost depends on the size of the
+// changes rather than the size of the trees. If resolve is nil, the first
+// key changed on both sides is reported as an error wrapping
+// ErrMergeConflict.
+//
+// Changes are detected by identity rather than by value, so a key that was
+// overwritten with an equal value on both sides is still passed to resolve.
+func Merge3[T any](base, ours, theirs *Tree[T], resolve MergeFn[T]) (*Tree[T], error) {
+	switch {
+	case theirs.root == base.root:
+		return ours, nil
+	case ours.root == base.root:
+		return theirs, nil
+	}
+
+	txn := ours.Txn()
+	var err error
+	diffNodes(base.root, theirs.root, func(k []byte, baseLeaf, theirLeaf *leafNode[T]) bool {
+		ourLeaf := ours.root.getLeaf(k)
+		switch {
+		case ourLeaf == baseLeaf:
+			// Only their side changed it.
+			if theirLeaf == nil {
+				txn.Delete(k)
+			} else {
+				txn.Insert(k, theirLeaf.val)
+			}
+			return false
+
+		case ourLeaf == theirLeaf:
+			// Both made the same change, or both deleted it.
+			return false
+
+		case resolve == nil:
+			err = fmt.Errorf("%w %q", ErrMergeConflict, k)
+			return true
+		}
+
+		v, ok := resolve(k, leafMergeValue(baseLeaf), leafMergeValue(ourLeaf), leafMergeValue(theirLeaf))
+		if ok {
+			txn.Insert(k, v)
+		} else {
+			txn.Delete(k)
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return txn.Commit(), nil
+}
+
+// leafMergeValue converts a possibly nil leaf into a MergeValue.
+func leafMergeValue[T any](l *leafNode[T]) MergeValue[T] {
+	if l == nil {
+		return MergeValue[T]{}
+	}
+	return MergeValue[T]{Val: l.val, Found: true}
+}
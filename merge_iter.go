@@ -0,0 +1,273 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"container/heap"
+)
+
+// MergePrecedence decides which source a merge iterator takes an entry from
+// when several of its sources hold the same key.
+type MergePrecedence int
+
+const (
+	// MergeFirstWins takes the entry from the source given first, which
+	// suits layers ordered from newest to oldest.
+	MergeFirstWins MergePrecedence = iota
+
+	// MergeLastWins takes the entry from the source given last, which suits
+	// layers ordered from oldest to newest.
+	MergeLastWins
+
+	// MergeKeepAll returns the entry from every source, in the order the
+	// sources were given.
+	MergeKeepAll
+)
+
+// mergeSource is one of the sources of a merge iterator along with its next
+// entry.
+type mergeSource[T any] struct {
+	idx  int
+	next func() ([]byte, T, bool)
+	k    []byte
+	v    T
+}
+
+// mergeHeap orders sources by their next key, in reverse if asked, and then
+// by the order the sources were given.
+type mergeHeap[T any] struct {
+	srcs    []*mergeSource[T]
+	reverse bool
+}
+
+func (h *mergeHeap[T]) Len() int { return len(h.srcs) }
+
+func (h *mergeHeap[T]) Less(i, j int) bool {
+	cmp := bytes.Compare(h.srcs[i].k, h.srcs[j].k)
+	if h.reverse {
+		cmp = -cmp
+	}
+	if cmp != 0 {
+		return cmp < 0
+	}
+	return h.srcs[i].idx < h.srcs[j].idx
+}
+
+func (h *mergeHeap[T]) Swap(i, j int) { h.srcs[i], h.srcs[j] = h.srcs[j], h.srcs[i] }
+
+func (h *mergeHeap[T]) Push(x any) { h.srcs = append(h.srcs, x.(*mergeSource[T])) }
+
+func (h *mergeHeap[T]) Pop() any {
+	n := len(h.srcs)
+	x := h.srcs[n-1]
+	h.srcs = h.srcs[:n-1]
+	return x
+}
+
+// merger holds the state shared by MergeIterator and MergeReverseIterator.
+type merger[T any] struct {
+	precedence MergePrecedence
+	all        []*mergeSource[T]
+	h          mergeHeap[T]
+	primed     bool
+
+	// dups holds the sources positioned on the current key, in source
+	// order, while they are being resolved.
+	dups []*mergeSource[T]
+
+	// source is the index of the source of the last returned entry.
+	source int
+}
+
+func newMerger[T any](precedence MergePrecedence, reverse bool, nexts []func() ([]byte, T, bool)) merger[T] {
+	m := merger[T]{
+		precedence: precedence,
+		h:          mergeHeap[T]{reverse: reverse},
+		source:     -1,
+	}
+	for i, next := range nexts {
+		m.all = append(m.all, &mergeSource[T]{idx: i, next: next})
+	}
+	return m
+}
+
+// reset drops the entries read from the sources, so that they are read
+// again once the sources have been seeked.
+func (m *merger[T]) reset() {
+	m.h.srcs = m.h.srcs[:0]
+	m.dups = m.dups[:0]
+	m.primed = false
+	m.source = -1
+}
+
+// advance moves a source to its next entry, putting it back on the heap if
+// there is one.
+func (m *merger[T]) advance(s *mergeSource[T]) {
+	var ok bool
+	s.k, s.v, ok = s.next()
+	if ok {
+		heap.Push(&m.h, s)
+	}
+}
+
+func (m *merger[T]) next() ([]byte, T, bool) {
+	if !m.primed {
+		// Sources can be seeked after the iterator is created, so they are
+		// only read once iteration starts.
+		for _, s := range m.all {
+			m.advance(s)
+		}
+		m.primed = true
+	}
+
+	if m.h.Len() == 0 {
+		var zero T
+		m.source = -1
+		return nil, zero, false
+	}
+
+	if m.precedence == MergeKeepAll {
+		s := heap.Pop(&m.h).(*mergeSource[T])
+		k, v := s.k, s.v
+		m.source = s.idx
+		m.advance(s)
+		return k, v, true
+	}
+
+	// Pull every source positioned on the smallest key. The heap breaks
+	// ties by source order, so they come out in the order given.
+	m.dups = m.dups[:0]
+	m.dups = append(m.dups, heap.Pop(&m.h).(*mergeSource[T]))
+	for m.h.Len() > 0 && bytes.Equal(m.h.srcs[0].k, m.dups[0].k) {
+		m.dups = append(m.dups, heap.Pop(&m.h).(*mergeSource[T]))
+	}
+
+	win := m.dups[0]
+	if m.precedence == MergeLastWins {
+		win = m.dups[len(m.dups)-1]
+	}
+	k, v := win.k, win.v
+	m.source = win.idx
+	for _, s := range m.dups {
+		m.advance(s)
+	}
+	return k, v, true
+}
+
+// MergeIterator combines several iterators into a single sorted stream of
+// entries, with a MergePrecedence deciding between sources that hold the
+// same key. Seeking it seeks every source and starts the merge over.
+type MergeIterator[T any] struct {
+	iters []*Iterator[T]
+	m     merger[T]
+}
+
+// NewMergeIterator returns a MergeIterator over the given iterators, which
+// may already have been seeked.
+func NewMergeIterator[T any](precedence MergePrecedence, iters ...*Iterator[T]) *MergeIterator[T] {
+	nexts := make([]func() ([]byte, T, bool), len(iters))
+	for i, iter := range iters {
+		nexts[i] = iter.Next
+	}
+	return &MergeIterator[T]{
+		iters: iters,
+		m:     newMerger(precedence, false, nexts),
+	}
+}
+
+// MergeNodes returns a MergeIterator over the entries under the given nodes.
+func MergeNodes[T any](precedence MergePrecedence, nodes ...*Node[T]) *MergeIterator[T] {
+	iters := make([]*Iterator[T], len(nodes))
+	for i, n := range nodes {
+		iters[i] = n.Iterator()
+	}
+	return NewMergeIterator(precedence, iters...)
+}
+
+// SeekPrefix is used to seek every source to a given prefix.
+func (i *MergeIterator[T]) SeekPrefix(prefix []byte) {
+	for _, iter := range i.iters {
+		iter.SeekPrefix(prefix)
+	}
+	i.m.reset()
+}
+
+// SeekLowerBound is used to seek every source to the smallest key that is
+// greater or equal to the given key.
+func (i *MergeIterator[T]) SeekLowerBound(key []byte) {
+	for _, iter := range i.iters {
+		iter.SeekLowerBound(key)
+	}
+	i.m.reset()
+}
+
+// Next returns the next entry in order.
+func (i *MergeIterator[T]) Next() ([]byte, T, bool) {
+	return i.m.next()
+}
+
+// Source returns the index of the source that the last entry returned by
+// Next came from, or -1 if there was none.
+func (i *MergeIterator[T]) Source() int {
+	return i.m.source
+}
+
+// MergeReverseIterator is like MergeIterator but combines reverse
+// iterators, returning entries in reverse order.
+type MergeReverseIterator[T any] struct {
+	iters []*ReverseIterator[T]
+	m     merger[T]
+}
+
+// NewMergeReverseIterator returns a MergeReverseIterator over the given
+// reverse iterators, which may already have been seeked.
+func NewMergeReverseIterator[T any](precedence MergePrecedence, iters ...*ReverseIterator[T]) *MergeReverseIterator[T] {
+	nexts := make([]func() ([]byte, T, bool), len(iters))
+	for i, iter := range iters {
+		nexts[i] = iter.Previous
+	}
+	return &MergeReverseIterator[T]{
+		iters: iters,
+		m:     newMerger(precedence, true, nexts),
+	}
+}
+
+// MergeNodesReverse returns a MergeReverseIterator over the entries under
+// the given nodes.
+func MergeNodesReverse[T any](precedence MergePrecedence, nodes ...*Node[T]) *MergeReverseIterator[T] {
+	iters := make([]*ReverseIterator[T], len(nodes))
+	for i, n := range nodes {
+		iters[i] = n.ReverseIterator()
+	}
+	return NewMergeReverseIterator(precedence, iters...)
+}
+
+// SeekPrefix is used to seek every source to a given prefix.
+func (ri *MergeReverseIterator[T]) SeekPrefix(prefix []byte) {
+	for _, iter := range ri.iters {
+		iter.SeekPrefix(prefix)
+	}
+	ri.m.reset()
+}
+
+// SeekReverseLowerBound is used to seek every source to the largest key
+// that is lower or equal to the given key.
+func (ri *MergeReverseIterator[T]) SeekReverseLowerBound(key []byte) {
+	for _, iter := range ri.iters {
+		iter.SeekReverseLowerBound(key)
+	}
+	ri.m.reset()
+}
+
+// Previous returns the previous entry in reverse order.
+func (ri *MergeReverseIterator[T]) Previous() ([]byte, T, bool) {
+	return ri.m.next()
+}
+
+// Source returns the index of the source that the last entry returned by
+// Previous came from, or -1 if there was none.
+func (ri *MergeReverseIterator[T]) Source() int {
+	return ri.m.source
+}
@@ -0,0 +1,162 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mergeLayers() []*Node[string] {
+	layers := [][]string{
+		{"b", "d", "f"},
+		{"a", "b", "c", "f"},
+		{"b", "e", "f", "g"},
+	}
+	var out []*Node[string]
+	for i, keys := range layers {
+		txn := New[string]().Txn()
+		for _, k := range keys {
+			txn.Insert([]byte(k), k+string(rune('0'+i)))
+		}
+		out = append(out, txn.Commit().Root())
+	}
+	return out
+}
+
+func TestMergeIterator(t *testing.T) {
+	cases := []struct {
+		precedence MergePrecedence
+		want       []string
+	}{
+		{MergeFirstWins, []string{"a1", "b0", "c1", "d0", "e2", "f0", "g2"}},
+		{MergeLastWins, []string{"a1", "b2", "c1", "d0", "e2", "f2", "g2"}},
+		{MergeKeepAll, []string{"a1", "b0", "b1", "b2", "c1", "d0", "e2", "f0", "f1", "f2", "g2"}},
+	}
+	for _, c := range cases {
+		var got []string
+		iter := MergeNodes(c.precedence, mergeLayers()...)
+		for k, v, ok := iter.Next(); ok; k, v, ok = iter.Next() {
+			if v[:1] != string(k) || iter.Source() != int(v[1]-'0') {
+				t.Fatalf("bad: %q %q %d", k, v, iter.Source())
+			}
+			got = append(got, v)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("bad %d: %v", c.precedence, got)
+		}
+		if iter.Source() != -1 {
+			t.Fatalf("bad: %d", iter.Source())
+		}
+
+		// The reverse iterator returns the same entries backwards, with
+		// duplicates still in source order.
+		got = nil
+		riter := MergeNodesReverse(c.precedence, mergeLayers()...)
+		for _, v, ok := riter.Previous(); ok; _, v, ok = riter.Previous() {
+			got = append(got, v)
+		}
+		var want []string
+		for i := len(c.want) - 1; i >= 0; i-- {
+			j := i
+			for j > 0 && c.want[j-1][0] == c.want[i][0] {
+				j--
+			}
+			want = append(want, c.want[j:i+1]...)
+			i = j
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("bad reverse %d: %v", c.precedence, got)
+		}
+	}
+}
+
+func TestMergeIterator_Seek(t *testing.T) {
+	layers := mergeLayers()
+
+	// Sources seeked before they are merged.
+	a, b := layers[0].Iterator(), layers[2].Iterator()
+	a.SeekLowerBound([]byte("c"))
+	b.SeekLowerBound([]byte("c"))
+	var got []string
+	iter := NewMergeIterator(MergeFirstWins, a, b)
+	for _, v, ok := iter.Next(); ok; _, v, ok = iter.Next() {
+		got = append(got, v)
+	}
+	if !reflect.DeepEqual(got, []string{"d0", "e2", "f0", "g2"}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	got = nil
+	iter = MergeNodes(MergeLastWins, layers...)
+	iter.SeekPrefix([]byte("b"))
+	for _, v, ok := iter.Next(); ok; _, v, ok = iter.Next() {
+		got = append(got, v)
+	}
+	if !reflect.DeepEqual(got, []string{"b2"}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	got = nil
+	riter := MergeNodesReverse(MergeFirstWins, layers...)
+	riter.SeekReverseLowerBound([]byte("ee"))
+	for _, v, ok := riter.Previous(); ok; _, v, ok = riter.Previous() {
+		got = append(got, v)
+	}
+	if !reflect.DeepEqual(got, []string{"e2", "d0", "c1", "b0", "a1"}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Seeking after iteration has started starts the merge over.
+	got = nil
+	iter = MergeNodes(MergeFirstWins, layers...)
+	iter.Next()
+	iter.Next()
+	iter.SeekLowerBound([]byte("e"))
+	for _, v, ok := iter.Next(); ok; _, v, ok = iter.Next() {
+		got = append(got, v)
+	}
+	if !reflect.DeepEqual(got, []string{"e2", "f0", "g2"}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	got = nil
+	iter = MergeNodes(MergeKeepAll, layers...)
+	iter.Next()
+	iter.SeekPrefix([]byte("f"))
+	for _, v, ok := iter.Next(); ok; _, v, ok = iter.Next() {
+		got = append(got, v)
+	}
+	if !reflect.DeepEqual(got, []string{"f0", "f1", "f2"}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	got = nil
+	riter = MergeNodesReverse(MergeLastWins, layers...)
+	riter.Previous()
+	riter.Previous()
+	riter.SeekReverseLowerBound([]byte("c"))
+	for _, v, ok := riter.Previous(); ok; _, v, ok = riter.Previous() {
+		got = append(got, v)
+	}
+	if !reflect.DeepEqual(got, []string{"c1", "b2", "a1"}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	got = nil
+	riter = MergeNodesReverse(MergeFirstWins, layers...)
+	riter.Previous()
+	riter.SeekPrefix([]byte("b"))
+	for _, v, ok := riter.Previous(); ok; _, v, ok = riter.Previous() {
+		got = append(got, v)
+	}
+	if !reflect.DeepEqual(got, []string{"b0"}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// No sources at all.
+	if _, _, ok := MergeNodes[string](MergeFirstWins).Next(); ok {
+		t.Fatalf("should be empty")
+	}
+}
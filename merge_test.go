@@ -0,0 +1,104 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	base := New[int]()
+	for i, k := range []string{"a", "b", "c", "d", "e", "f"} {
+		base, _, _ = base.Insert([]byte(k), i)
+	}
+
+	txn := base.Txn()
+	txn.Insert([]byte("shared"), 100)
+	theirTxn := txn.Clone()
+
+	txn.Insert([]byte("a"), 10)
+	txn.Delete([]byte("b"))
+	txn.Insert([]byte("c"), 20)
+	txn.Delete([]byte("e"))
+	txn.Insert([]byte("ours"), 1)
+	ours := txn.Commit()
+
+	theirTxn.Insert([]byte("c"), 30)
+	theirTxn.Delete([]byte("d"))
+	theirTxn.Delete([]byte("e"))
+	theirTxn.Insert([]byte("f"), 40)
+	theirTxn.Insert([]byte("theirs"), 2)
+	theirs := theirTxn.Commit()
+
+	var conflicts []string
+	out, err := Merge3(base, ours, theirs, func(k []byte, b, o, th MergeValue[int]) (int, bool) {
+		conflicts = append(conflicts, string(k))
+		if !b.Found || !o.Found || !th.Found {
+			t.Fatalf("bad conflict values for %q", k)
+		}
+		return b.Val + o.Val + th.Val, true
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The shared insert was made before the clone, so both sides hold the
+	// same leaf and it isn't a conflict.
+	if !reflect.DeepEqual(conflicts, []string{"c"}) {
+		t.Fatalf("bad conflicts: %v", conflicts)
+	}
+	expect := map[string]int{
+		"a":      10,
+		"c":      2 + 20 + 30,
+		"f":      40,
+		"ours":   1,
+		"shared": 100,
+		"theirs": 2,
+	}
+	got := make(map[string]int)
+	out.Root().Walk(func(k []byte, v int) bool {
+		got[string(k)] = v
+		return false
+	})
+	if !reflect.DeepEqual(got, expect) || out.Len() != len(expect) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	if _, err := Merge3(base, ours, theirs, nil); !errors.Is(err, ErrMergeConflict) {
+		t.Fatalf("expected conflict, got: %v", err)
+	}
+}
+
+func TestMerge3_Unchanged(t *testing.T) {
+	base, _, _ := New[int]().Insert([]byte("foo"), 1)
+	changed, _, _ := base.Insert([]byte("bar"), 2)
+
+	if out, _ := Merge3(base, base, changed, nil); out != changed {
+		t.Fatalf("should return their side")
+	}
+	if out, _ := Merge3(base, changed, base, nil); out != changed {
+		t.Fatalf("should return our side")
+	}
+}
+
+func TestMerge3_ConflictDelete(t *testing.T) {
+	base, _, _ := New[int]().Insert([]byte("foo"), 1)
+	ours, _, _ := base.Delete([]byte("foo"))
+	theirs, _, _ := base.Insert([]byte("foo"), 2)
+
+	out, err := Merge3(base, ours, theirs, func(k []byte, b, o, th MergeValue[int]) (int, bool) {
+		if o.Found || !th.Found {
+			t.Fatalf("bad conflict values")
+		}
+		return 0, false
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("bad len: %d", out.Len())
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Snapshot is an immutable set of named trees, which may each hold a
+// different value type. A Snapshot is built from existing trees with
+// SnapshotWith or produced by committing a MultiTxn, and is never changed
+// afterwards.
+type Snapshot struct {
+	trees map[string]any
+}
+
+// NewSnapshot returns an empty Snapshot.
+func NewSnapshot() *Snapshot {
+	return &Snapshot{trees: make(map[string]any)}
+}
+
+// SnapshotWith returns a new Snapshot holding the trees of s, with the named
+// tree set to t. Any existing tree with that name is replaced, whatever its
+// value type. The snapshot s is left unchanged.
+func SnapshotWith[T any](s *Snapshot, name string, t *Tree[T]) *Snapshot {
+	trees := make(map[string]any, len(s.trees)+1)
+	for n, old := range s.trees {
+		trees[n] = old
+	}
+	trees[name] = t
+	return &Snapshot{trees: trees}
+}
+
+// Names returns the names of the trees in the snapshot in sorted order.
+func (s *Snapshot) Names() []string {
+	names := make([]string, 0, len(s.trees))
+	for name := range s.trees {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ErrTreeType is returned by MultiTxnTree when the named tree holds a
+// different value type.
+var ErrTreeType = errors.New("iradix: tree holds a different value type")
+
+// SnapshotTree returns the named tree from the snapshot, or false if there
+// is no tree with that name or the tree has a different value type.
+func SnapshotTree[T any](s *Snapshot, name string) (*Tree[T], bool) {
+	t, ok := s.trees[name].(*Tree[T])
+	return t, ok
+}
+
+// multiEntry hides the value type of a transaction taking part in a
+// MultiTxn.
+type multiEntry interface {
+	commitOnly() any
+	notify()
+	trackMutate(track bool)
+}
+
+// multiTxnEntry adapts a *Txn[T] to multiEntry.
+type multiTxnEntry[T any] struct {
+	txn *Txn[T]
+}
+
+func (e multiTxnEntry[T]) commitOnly() any        { return e.txn.CommitOnly() }
+func (e multiTxnEntry[T]) notify()                { e.txn.Notify() }
+func (e multiTxnEntry[T]) trackMutate(track bool) { e.txn.TrackMutate(track) }
+
+// MultiTxn is a transaction across all the trees of a Snapshot. It holds one
+// Txn per tree that has been written to, and commits them all into a new
+// Snapshot at once. Like Txn it is not thread safe.
+type MultiTxn struct {
+	snap        *Snapshot
+	txns        map[string]multiEntry
+	trackMutate bool
+}
+
+// Txn starts a new transaction across the trees of the snapshot.
+func (s *Snapshot) Txn() *MultiTxn {
+	return &MultiTxn{
+		snap: s,
+		txns: make(map[string]multiEntry),
+	}
+}
+
+// MultiTxnTree returns the transaction for the named tree, starting one if
+// needed. If the snapshot has no tree with that name an empty one is
+// created. If the tree has a different value type an error wrapping
+// ErrTreeType is returned.
+func MultiTxnTree[T any](m *MultiTxn, name string) (*Txn[T], error) {
+	if raw, ok := m.txns[name]; ok {
+		e, ok := raw.(multiTxnEntry[T])
+		if !ok {
+			return nil, fmt.Errorf("%w: tree %q is not a tree of %T", ErrTreeType, name, *new(T))
+		}
+		return e.txn, nil
+	}
+
+	var t *Tree[T]
+	if raw, ok := m.snap.trees[name]; ok {
+		if t, ok = raw.(*Tree[T]); !ok {
+			return nil, fmt.Errorf("%w: tree %q holds %T, not %T", ErrTreeType, name, raw, t)
+		}
+	} else {
+		t = New[T]()
+	}
+	txn := t.Txn()
+	txn.TrackMutate(m.trackMutate)
+	m.txns[name] = multiTxnEntry[T]{txn}
+	return txn, nil
+}
+
+// TrackMutate toggles mutation tracking on every tree's transaction,
+// including the ones started later.
+func (m *MultiTxn) TrackMutate(track bool) {
+	m.trackMutate = track
+	for _, e := range m.txns {
+		e.trackMutate(track)
+	}
+}
+
+// CommitOnly commits every tree's transaction and returns the resulting
+// Snapshot, but does not issue any notifications until Notify is called.
+func (m *MultiTxn) CommitOnly() *Snapshot {
+	trees := make(map[string]any, len(m.snap.trees)+len(m.txns))
+	for name, t := range m.snap.trees {
+		trees[name] = t
+	}
+	for name, e := range m.txns {
+		trees[name] = e.commitOnly()
+	}
+	return &Snapshot{trees: trees}
+}
+
+// Notify issues the mutation notifications for every tree. This must only
+// be done once the Snapshot returned by CommitOnly has been made visible to
+// readers, and it is called automatically by Commit.
+func (m *MultiTxn) Notify() {
+	for _, e := range m.txns {
+		e.notify()
+	}
+}
+
+// Commit commits every tree's transaction and then issues notifications,
+// returning the resulting Snapshot.
+func (m *MultiTxn) Commit() *Snapshot {
+	s := m.CommitOnly()
+	m.Notify()
+	return s
+}
+
+// MultiStore holds the current Snapshot of a set of trees, in the same way
+// that Store holds a single tree. Reads never block, writers are serialized
+// and notifications for every tree are only issued once the whole new
+// Snapshot is visible.
+type MultiStore struct {
+	// snap holds the current *Snapshot.
+	snap atomic.Value
+
+	// writeLock serializes commits.
+	writeLock sync.Mutex
+}
+
+// NewMultiStore returns a MultiStore whose current snapshot is s.
+func NewMultiStore(s *Snapshot) *MultiStore {
+	ms := &MultiStore{}
+	ms.snap.Store(s)
+	return ms
+}
+
+// Snapshot returns the current snapshot.
+func (ms *MultiStore) Snapshot() *Snapshot {
+	return ms.snap.Load().(*Snapshot)
+}
+
+// Update runs fn with a transaction on the current snapshot and publishes
+// the result if fn returns nil. If fn returns an error nothing is committed
+// and the error is returned.
+func (ms *MultiStore) Update(fn func(m *MultiTxn) error) (*Snapshot, error) {
+	ms.writeLock.Lock()
+	defer ms.writeLock.Unlock()
+
+	m := ms.Snapshot().Txn()
+	if err := fn(m); err != nil {
+		return nil, err
+	}
+	s := m.CommitOnly()
+	ms.snap.Store(s)
+	m.Notify()
+	return s, nil
+}
@@ -0,0 +1,143 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMultiTxn(t *testing.T) {
+	s := NewSnapshot()
+
+	m := s.Txn()
+	mustMultiTxnTree[int](t, m, "users").Insert([]byte("alice"), 1)
+	mustMultiTxnTree[string](t, m, "emails").Insert([]byte("alice"), "alice@example.com")
+	mustMultiTxnTree[int](t, m, "users").Insert([]byte("bob"), 2)
+	s1 := m.Commit()
+
+	if !reflect.DeepEqual(s1.Names(), []string{"emails", "users"}) {
+		t.Fatalf("bad: %v", s1.Names())
+	}
+	users, ok := SnapshotTree[int](s1, "users")
+	if !ok || users.Len() != 2 {
+		t.Fatalf("bad users")
+	}
+	emails, _ := SnapshotTree[string](s1, "emails")
+	if v, _ := emails.Get([]byte("alice")); v != "alice@example.com" {
+		t.Fatalf("bad: %v", v)
+	}
+	if _, ok := SnapshotTree[int](s, "users"); ok {
+		t.Fatalf("original snapshot should be unchanged")
+	}
+
+	// Trees that aren't touched carry over as is.
+	m = s1.Txn()
+	mustMultiTxnTree[int](t, m, "users").Delete([]byte("bob"))
+	s2 := m.Commit()
+	emails2, _ := SnapshotTree[string](s2, "emails")
+	if emails2 != emails {
+		t.Fatalf("untouched tree should be shared")
+	}
+	if users2, _ := SnapshotTree[int](s2, "users"); users2.Len() != 1 {
+		t.Fatalf("bad len: %d", users2.Len())
+	}
+
+	// A tree with a different value type is reported, both when it's in the
+	// snapshot and when it's already part of the transaction.
+	if tree, ok := SnapshotTree[string](s2, "users"); ok || tree != nil {
+		t.Fatalf("bad: %v %v", tree, ok)
+	}
+	m = s2.Txn()
+	if _, err := MultiTxnTree[string](m, "users"); !errors.Is(err, ErrTreeType) {
+		t.Fatalf("err: %v", err)
+	}
+	mustMultiTxnTree[string](t, m, "new")
+	if _, err := MultiTxnTree[int](m, "new"); !errors.Is(err, ErrTreeType) {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func mustMultiTxnTree[T any](t *testing.T, m *MultiTxn, name string) *Txn[T] {
+	t.Helper()
+	txn, err := MultiTxnTree[T](m, name)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return txn
+}
+
+func TestSnapshotWith(t *testing.T) {
+	users, _, _ := New[int]().Insert([]byte("alice"), 1)
+	emails, _, _ := New[string]().Insert([]byte("alice"), "alice@example.com")
+
+	empty := NewSnapshot()
+	s := SnapshotWith(SnapshotWith(empty, "users", users), "emails", emails)
+	if names := empty.Names(); len(names) != 0 {
+		t.Fatalf("bad: %v", names)
+	}
+	if names := s.Names(); len(names) != 2 || names[0] != "emails" || names[1] != "users" {
+		t.Fatalf("bad: %v", names)
+	}
+	if tree, ok := SnapshotTree[int](s, "users"); !ok || tree != users {
+		t.Fatalf("bad: %v %v", tree, ok)
+	}
+
+	// Trees added this way can be written through a MultiTxn.
+	m := s.Txn()
+	mustMultiTxnTree[int](t, m, "users").Insert([]byte("bob"), 2)
+	next := m.Commit()
+	tree, _ := SnapshotTree[int](next, "users")
+	if tree.Len() != 2 {
+		t.Fatalf("bad: %d", tree.Len())
+	}
+	if tree, _ := SnapshotTree[string](next, "emails"); tree != emails {
+		t.Fatalf("bad: %v", tree)
+	}
+
+	// A tree of another value type replaces the old one.
+	s = SnapshotWith(s, "users", emails)
+	if _, ok := SnapshotTree[int](s, "users"); ok {
+		t.Fatalf("bad: old tree still present")
+	}
+}
+
+func TestMultiStore_Notify(t *testing.T) {
+	ms := NewMultiStore(NewSnapshot())
+	if _, err := ms.Update(func(m *MultiTxn) error {
+		mustMultiTxnTree[int](t, m, "a").Insert([]byte("foo"), 1)
+		mustMultiTxnTree[int](t, m, "b").Insert([]byte("foo"), 1)
+		return nil
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	a, _ := SnapshotTree[int](ms.Snapshot(), "a")
+	watch, _, _ := a.Root().GetWatch([]byte("foo"))
+
+	// When the watch on tree a fires, the change to tree b made in the
+	// same transaction must already be visible.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-watch
+		b, _ := SnapshotTree[int](ms.Snapshot(), "b")
+		if v, _ := b.Get([]byte("foo")); v != 2 {
+			t.Errorf("watcher saw stale snapshot: %d", v)
+		}
+	}()
+
+	if _, err := ms.Update(func(m *MultiTxn) error {
+		m.TrackMutate(true)
+		mustMultiTxnTree[int](t, m, "a").Insert([]byte("foo"), 2)
+		mustMultiTxnTree[int](t, m, "b").Insert([]byte("foo"), 2)
+		return nil
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	wg.Wait()
+}
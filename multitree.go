@@ -0,0 +1,183 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import "fmt"
+
+// MultiTree is an immutable tree that holds an ordered collection of
+// distinct values under each key. Every key and value pair is stored as its
+// own entry, keyed by the escaped key followed by the value encoded with a
+// KeyCodec, so adding or removing a single value doesn't copy the other
+// values under the key, and values are kept in the codec's order.
+type MultiTree[T any] struct {
+	tree  *Tree[T]
+	codec KeyCodec[T]
+}
+
+// NewMultiTree returns an empty MultiTree that orders values with codec.
+func NewMultiTree[T any](codec KeyCodec[T]) *MultiTree[T] {
+	return &MultiTree[T]{tree: New[T](), codec: codec}
+}
+
+// Len returns the number of key and value pairs in the tree.
+func (m *MultiTree[T]) Len() int {
+	return m.tree.Len()
+}
+
+// Has returns true if the value is stored under the key.
+func (m *MultiTree[T]) Has(k []byte, v T) bool {
+	_, ok := m.tree.Get(m.entryKey(k, v))
+	return ok
+}
+
+// Values returns the values stored under the key, in order.
+func (m *MultiTree[T]) Values(k []byte) []T {
+	return multiValues(m.tree.Root(), k)
+}
+
+// ValuesWatch returns the values stored under the key, in order, along with
+// a watch channel that is closed when they change.
+func (m *MultiTree[T]) ValuesWatch(k []byte) (<-chan struct{}, []T) {
+	iter := m.tree.Root().Iterator()
+	watch := iter.SeekPrefixWatch(escapeKey(k))
+	var out []T
+	for _, v, ok := iter.Next(); ok; _, v, ok = iter.Next() {
+		out = append(out, v)
+	}
+	return watch, out
+}
+
+// Add returns a new tree with the value added under the key, and a bool
+// indicating if it was already there.
+func (m *MultiTree[T]) Add(k []byte, v T) (*MultiTree[T], bool) {
+	txn := m.Txn()
+	ok := txn.Add(k, v)
+	return txn.Commit(), ok
+}
+
+// RemoveValue returns a new tree with the value removed from under the key,
+// and a bool indicating if it was there.
+func (m *MultiTree[T]) RemoveValue(k []byte, v T) (*MultiTree[T], bool) {
+	txn := m.Txn()
+	ok := txn.RemoveValue(k, v)
+	return txn.Commit(), ok
+}
+
+// RemoveKey returns a new tree with every value under the key removed, and
+// a bool indicating if there were any.
+func (m *MultiTree[T]) RemoveKey(k []byte) (*MultiTree[T], bool) {
+	txn := m.Txn()
+	ok := txn.RemoveKey(k)
+	return txn.Commit(), ok
+}
+
+// entryKey returns the key of the entry for v under k.
+func (m *MultiTree[T]) entryKey(k []byte, v T) []byte {
+	return m.codec.AppendKey(escapeKey(k), v)
+}
+
+// multiValues collects the values under k from the entries under root.
+func multiValues[T any](root *Node[T], k []byte) []T {
+	var out []T
+	root.WalkPrefix(escapeKey(k), func(_ []byte, v T) bool {
+		out = append(out, v)
+		return false
+	})
+	return out
+}
+
+// MultiTreeIterator is used to iterate over the key and value pairs of a
+// MultiTree, in key order and then value order.
+type MultiTreeIterator[T any] struct {
+	i *Iterator[T]
+}
+
+// Iterator returns an iterator over the tree.
+func (m *MultiTree[T]) Iterator() *MultiTreeIterator[T] {
+	return &MultiTreeIterator[T]{i: m.tree.Root().Iterator()}
+}
+
+// SeekPrefix is used to seek the iterator to the keys starting with a given
+// prefix.
+func (mi *MultiTreeIterator[T]) SeekPrefix(prefix []byte) {
+	ek := escapeKey(prefix)
+	mi.i.SeekPrefix(ek[:len(ek)-2])
+}
+
+// SeekLowerBound is used to seek the iterator to the first value of the
+// smallest key that is greater or equal to the given key.
+func (mi *MultiTreeIterator[T]) SeekLowerBound(key []byte) {
+	mi.i.SeekLowerBound(escapeKey(key))
+}
+
+// Next returns the next key and value pair in order.
+func (mi *MultiTreeIterator[T]) Next() ([]byte, T, bool) {
+	ek, v, ok := mi.i.Next()
+	if !ok {
+		return nil, v, false
+	}
+	k, _, ok := unescapeKey(ek)
+	if !ok {
+		panic(fmt.Sprintf("iradix: invalid multitree entry key %x", ek))
+	}
+	return k, v, true
+}
+
+// MultiTreeTxn is a transaction on a MultiTree. Like Txn it is not thread
+// safe.
+type MultiTreeTxn[T any] struct {
+	txn   *Txn[T]
+	codec KeyCodec[T]
+}
+
+// Txn starts a new transaction that can be used to mutate the tree.
+func (m *MultiTree[T]) Txn() *MultiTreeTxn[T] {
+	return &MultiTreeTxn[T]{txn: m.tree.Txn(), codec: m.codec}
+}
+
+// TrackMutate can be used to toggle if mutations are tracked, see
+// Txn.TrackMutate.
+func (t *MultiTreeTxn[T]) TrackMutate(track bool) {
+	t.txn.TrackMutate(track)
+}
+
+// Has returns true if the value is stored under the key.
+func (t *MultiTreeTxn[T]) Has(k []byte, v T) bool {
+	_, ok := t.txn.Get(t.codec.AppendKey(escapeKey(k), v))
+	return ok
+}
+
+// Values returns the values stored under the key, in order.
+func (t *MultiTreeTxn[T]) Values(k []byte) []T {
+	return multiValues(t.txn.Root(), k)
+}
+
+// Add adds the value under the key, returning true if it was already there.
+func (t *MultiTreeTxn[T]) Add(k []byte, v T) bool {
+	ek := t.codec.AppendKey(escapeKey(k), v)
+	if _, ok := t.txn.Get(ek); ok {
+		return true
+	}
+	t.txn.Insert(ek, v)
+	return false
+}
+
+// RemoveValue removes the value from under the key, returning true if it was
+// there.
+func (t *MultiTreeTxn[T]) RemoveValue(k []byte, v T) bool {
+	_, ok := t.txn.Delete(t.codec.AppendKey(escapeKey(k), v))
+	return ok
+}
+
+// RemoveKey removes every value under the key, returning true if there were
+// any.
+func (t *MultiTreeTxn[T]) RemoveKey(k []byte) bool {
+	return t.txn.DeletePrefix(escapeKey(k))
+}
+
+// Commit is used to finalize the transaction and return a new tree. If
+// mutation tracking is turned on then notifications will also be issued.
+func (t *MultiTreeTxn[T]) Commit() *MultiTree[T] {
+	return &MultiTree[T]{tree: t.txn.Commit(), codec: t.codec}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestMultiTree(t *testing.T) {
+	m := NewMultiTree[uint64](UintKeyCodec[uint64]{})
+	txn := m.Txn()
+	txn.Add([]byte("tag/web"), 30)
+	txn.Add([]byte("tag/web"), 4)
+	txn.Add([]byte("tag/web"), 100)
+	txn.Add([]byte("tag/db"), 4)
+	txn.Add([]byte("tag/web\x00x"), 1)
+	if !txn.Add([]byte("tag/web"), 30) {
+		t.Fatalf("30 should already be there")
+	}
+	m = txn.Commit()
+
+	if m.Len() != 5 {
+		t.Fatalf("bad len: %d", m.Len())
+	}
+	if got := m.Values([]byte("tag/web")); !reflect.DeepEqual(got, []uint64{4, 30, 100}) {
+		t.Fatalf("bad: %v", got)
+	}
+	if got := m.Values([]byte("tag/web\x00x")); !reflect.DeepEqual(got, []uint64{1}) {
+		t.Fatalf("bad: %v", got)
+	}
+	if !m.Has([]byte("tag/db"), 4) || m.Has([]byte("tag/db"), 30) {
+		t.Fatalf("bad has")
+	}
+
+	var pairs []string
+	iter := m.Iterator()
+	iter.SeekPrefix([]byte("tag/"))
+	for k, v, ok := iter.Next(); ok; k, v, ok = iter.Next() {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", k, v))
+	}
+	want := []string{"tag/db=4", "tag/web=4", "tag/web=30", "tag/web=100", "tag/web\x00x=1"}
+	if !reflect.DeepEqual(pairs, want) {
+		t.Fatalf("bad: %q", pairs)
+	}
+
+	iter = m.Iterator()
+	iter.SeekLowerBound([]byte("tag/dc"))
+	if k, v, _ := iter.Next(); string(k) != "tag/web" || v != 4 {
+		t.Fatalf("bad: %q %d", k, v)
+	}
+
+	m2, ok := m.RemoveValue([]byte("tag/web"), 30)
+	if !ok || m2.Len() != 4 || m.Len() != 5 {
+		t.Fatalf("bad remove")
+	}
+	if got := m2.Values([]byte("tag/web")); !reflect.DeepEqual(got, []uint64{4, 100}) {
+		t.Fatalf("bad: %v", got)
+	}
+	m2, ok = m2.RemoveKey([]byte("tag/web"))
+	if !ok || m2.Len() != 2 {
+		t.Fatalf("bad remove key: %d", m2.Len())
+	}
+	if got := m2.Values([]byte("tag/web\x00x")); len(got) != 1 {
+		t.Fatalf("removed the wrong key: %v", got)
+	}
+}
+
+func TestMultiTree_Watch(t *testing.T) {
+	m := NewMultiTree[string](StringKeyCodec{})
+	m, _ = m.Add([]byte("a"), "x")
+	m, _ = m.Add([]byte("b"), "y")
+
+	watchA, vals := m.ValuesWatch([]byte("a"))
+	if !reflect.DeepEqual(vals, []string{"x"}) {
+		t.Fatalf("bad: %v", vals)
+	}
+	watchB, _ := m.ValuesWatch([]byte("b"))
+
+	txn := m.Txn()
+	txn.TrackMutate(true)
+	txn.Add([]byte("a"), "z")
+	if got := txn.Values([]byte("a")); !reflect.DeepEqual(got, []string{"x", "z"}) {
+		t.Fatalf("bad: %v", got)
+	}
+	txn.Commit()
+
+	select {
+	case <-watchA:
+	default:
+		t.Fatalf("watch on a should fire")
+	}
+	select {
+	case <-watchB:
+		t.Fatalf("watch on b should not fire")
+	default:
+	}
+}
+
+func TestEscapeKey(t *testing.T) {
+	for _, k := range []string{"", "a", "\x00", "a\x00\x01", "\x00\xff"} {
+		ek := append(escapeKey([]byte(k)), "rest"...)
+		got, rest, ok := unescapeKey(ek)
+		if !ok || string(got) != k || string(rest) != "rest" {
+			t.Fatalf("bad %q: %q %q %v", k, got, rest, ok)
+		}
+	}
+	if _, _, ok := unescapeKey([]byte("abc")); ok {
+		t.Fatalf("missing terminator should fail")
+	}
+}
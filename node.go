@@ -5,7 +5,6 @@ package iradix
 
 import (
 	"bytes"
-	"sort"
 )
 
 // WalkFn is used when walking the tree. Takes a
@@ -15,7 +14,7 @@ type WalkFn[T any] func(k []byte, v T) bool
 
 // leafNode is used to represent a value
 type leafNode[T any] struct {
-	mutateCh chan struct{}
+	mutateCh watchCh
 	key      []byte
 	val      T
 }
@@ -29,7 +28,7 @@ type edge[T any] struct {
 // Node is an immutable node in the radix tree
 type Node[T any] struct {
 	// mutateCh is closed if this node is modified
-	mutateCh chan struct{}
+	mutateCh watchCh
 
 	// leaf is used to store possible leaf
 	leaf *leafNode[T]
@@ -41,30 +40,91 @@ type Node[T any] struct {
 	// We avoid a fully materialized slice to save memory,
 	// since in most cases we expect to be sparse
 	edges edges[T]
+
+	// index speeds up finding edges in dense nodes, see buildIndex.
+	index *edgeIndex
 }
 
+// Nodes adapt how they find their edges to the number of edges they have,
+// in the spirit of the node kinds of an adaptive radix tree, while always
+// keeping the edges in a sorted slice so that iteration is unaffected:
+//
+//   - Up to linearEdges edges are searched linearly, which beats a binary
+//     search for such small slices.
+//   - Committed nodes with more edges keep an index from label to
+//     position, so that looking up an edge is a single array access.
+//   - A node with an edge for every possible label has its edge for a label
+//     at that label's position, so it needs no index.
+//
+// Nodes without an index, such as nodes still being changed by a
+// transaction, fall back to a binary search, so the index is only ever an
+// accelerator.
+const linearEdges = 16
+
+// edgeIndex maps an edge label to one more than the position of its edge
+// in the node's edges, with zero meaning there is no edge.
+type edgeIndex [256]uint8
+
 func (n *Node[T]) isLeaf() bool {
 	return n.leaf != nil
 }
 
+// searchEdges returns the position of the first edge whose label is greater
+// or equal to the given label.
+func (n *Node[T]) searchEdges(label byte) int {
+	num := len(n.edges)
+	if num == 256 {
+		return int(label)
+	}
+	if num <= linearEdges {
+		for i := 0; i < num; i++ {
+			if n.edges[i].label >= label {
+				return i
+			}
+		}
+		return num
+	}
+	lo, hi := 0, num
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if n.edges[mid].label < label {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// buildIndex gives n an index if it has enough edges to need one. It is
+// only called once n can no longer change, and copies of n share its index
+// until their edges change, so that copying a node never copies its index.
+func (n *Node[T]) buildIndex() {
+	num := len(n.edges)
+	if n.index != nil || num <= linearEdges || num == 256 {
+		return
+	}
+	index := new(edgeIndex)
+	for i, e := range n.edges {
+		index[e.label] = uint8(i + 1)
+	}
+	n.index = index
+}
+
 func (n *Node[T]) addEdge(e edge[T]) {
 	num := len(n.edges)
-	idx := sort.Search(num, func(i int) bool {
-		return n.edges[i].label >= e.label
-	})
+	idx := n.searchEdges(e.label)
 	n.edges = append(n.edges, e)
 	if idx != num {
 		copy(n.edges[idx+1:], n.edges[idx:num])
 		n.edges[idx] = e
 	}
+	n.index = nil
 }
 
 func (n *Node[T]) replaceEdge(e edge[T]) {
-	num := len(n.edges)
-	idx := sort.Search(num, func(i int) bool {
-		return n.edges[i].label >= e.label
-	})
-	if idx < num && n.edges[idx].label == e.label {
+	idx, child := n.getEdge(e.label)
+	if child != nil {
 		n.edges[idx].node = e.node
 		return
 	}
@@ -72,10 +132,14 @@ func (n *Node[T]) replaceEdge(e edge[T]) {
 }
 
 func (n *Node[T]) getEdge(label byte) (int, *Node[T]) {
+	if n.index != nil {
+		if i := int(n.index[label]); i != 0 {
+			return i - 1, n.edges[i-1].node
+		}
+		return -1, nil
+	}
 	num := len(n.edges)
-	idx := sort.Search(num, func(i int) bool {
-		return n.edges[i].label >= label
-	})
+	idx := n.searchEdges(label)
 	if idx < num && n.edges[idx].label == label {
 		return idx, n.edges[idx].node
 	}
@@ -84,9 +148,7 @@ func (n *Node[T]) getEdge(label byte) (int, *Node[T]) {
 
 func (n *Node[T]) getLowerBoundEdge(label byte) (int, *Node[T]) {
 	num := len(n.edges)
-	idx := sort.Search(num, func(i int) bool {
-		return n.edges[i].label >= label
-	})
+	idx := n.searchEdges(label)
 	// we want lower bound behavior so return even if it's not an exact match
 	if idx < num {
 		return idx, n.edges[idx].node
@@ -95,25 +157,31 @@ func (n *Node[T]) getLowerBoundEdge(label byte) (int, *Node[T]) {
 }
 
 func (n *Node[T]) delEdge(label byte) {
-	num := len(n.edges)
-	idx := sort.Search(num, func(i int) bool {
-		return n.edges[i].label >= label
-	})
-	if idx < num && n.edges[idx].label == label {
-		copy(n.edges[idx:], n.edges[idx+1:])
-		n.edges[len(n.edges)-1] = edge[T]{}
-		n.edges = n.edges[:len(n.edges)-1]
+	idx, child := n.getEdge(label)
+	if child == nil {
+		return
 	}
+	copy(n.edges[idx:], n.edges[idx+1:])
+	n.edges[len(n.edges)-1] = edge[T]{}
+	n.edges = n.edges[:len(n.edges)-1]
+	n.index = nil
 }
 
 func (n *Node[T]) GetWatch(k []byte) (<-chan struct{}, T, bool) {
+	watch, val, ok := n.getWatch(k)
+	return watch.get(), val, ok
+}
+
+// getWatch is like GetWatch, but returns the watch channel without making
+// it, so that lookups that don't watch don't allocate channels.
+func (n *Node[T]) getWatch(k []byte) (*watchCh, T, bool) {
 	search := k
-	watch := n.mutateCh
+	watch := &n.mutateCh
 	for {
 		// Check for key exhaustion
 		if len(search) == 0 {
 			if n.isLeaf() {
-				return n.leaf.mutateCh, n.leaf.val, true
+				return &n.leaf.mutateCh, n.leaf.val, true
 			}
 			break
 		}
@@ -125,7 +193,7 @@ func (n *Node[T]) GetWatch(k []byte) (<-chan struct{}, T, bool) {
 		}
 
 		// Update to the finest granularity as the search makes progress
-		watch = n.mutateCh
+		watch = &n.mutateCh
 
 		// Consume the search prefix
 		if bytes.HasPrefix(search, n.prefix) {
@@ -138,8 +206,21 @@ func (n *Node[T]) GetWatch(k []byte) (<-chan struct{}, T, bool) {
 	return watch, zero, false
 }
 
+// getLeaf returns the leaf stored under exactly the given key, or nil.
+func (n *Node[T]) getLeaf(k []byte) *leafNode[T] {
+	search := k
+	for len(search) > 0 {
+		_, n = n.getEdge(search[0])
+		if n == nil || !bytes.HasPrefix(search, n.prefix) {
+			return nil
+		}
+		search = search[len(n.prefix):]
+	}
+	return n.leaf
+}
+
 func (n *Node[T]) Get(k []byte) (T, bool) {
-	_, val, ok := n.GetWatch(k)
+	_, val, ok := n.getWatch(k)
 	return val, ok
 }
 
@@ -147,11 +228,13 @@ func (n *Node[T]) Get(k []byte) (T, bool) {
 // exact match, it will return the longest prefix match.
 func (n *Node[T]) LongestPrefix(k []byte) ([]byte, T, bool) {
 	var last *leafNode[T]
+	var lastLen int
 	search := k
 	for {
 		// Look for a leaf node
 		if n.isLeaf() {
 			last = n.leaf
+			lastLen = len(k) - len(search)
 		}
 
 		// Check for key exhaustion
@@ -173,7 +256,7 @@ func (n *Node[T]) LongestPrefix(k []byte) ([]byte, T, bool) {
 		}
 	}
 	if last != nil {
-		return last.key, last.val, true
+		return last.keyAt(k[:lastLen]), last.val, true
 	}
 	var zero T
 	return nil, zero, false
@@ -181,9 +264,14 @@ func (n *Node[T]) LongestPrefix(k []byte) ([]byte, T, bool) {
 
 // Minimum is used to return the minimum value in the tree
 func (n *Node[T]) Minimum() ([]byte, T, bool) {
+	compact := n.isCompact()
+	var path []byte
 	for {
+		if compact {
+			path = append(path, n.prefix...)
+		}
 		if n.isLeaf() {
-			return n.leaf.key, n.leaf.val, true
+			return n.leaf.keyAt(path), n.leaf.val, true
 		}
 		if len(n.edges) > 0 {
 			n = n.edges[0].node
@@ -197,13 +285,18 @@ func (n *Node[T]) Minimum() ([]byte, T, bool) {
 
 // Maximum is used to return the maximum value in the tree
 func (n *Node[T]) Maximum() ([]byte, T, bool) {
+	compact := n.isCompact()
+	var path []byte
 	for {
+		if compact {
+			path = append(path, n.prefix...)
+		}
 		if num := len(n.edges); num > 0 {
 			n = n.edges[num-1].node // bug?
 			continue
 		}
 		if n.isLeaf() {
-			return n.leaf.key, n.leaf.val, true
+			return n.leaf.keyAt(path), n.leaf.val, true
 		} else {
 			break
 		}
@@ -215,7 +308,7 @@ func (n *Node[T]) Maximum() ([]byte, T, bool) {
 // Iterator is used to return an iterator at
 // the given node to walk the tree
 func (n *Node[T]) Iterator() *Iterator[T] {
-	return &Iterator[T]{node: n}
+	return &Iterator[T]{node: n, compact: n.isCompact()}
 }
 
 // ReverseIterator is used to return an iterator at
@@ -227,7 +320,7 @@ func (n *Node[T]) ReverseIterator() *ReverseIterator[T] {
 // Iterator is used to return an iterator at
 // the given node to walk the tree
 func (n *Node[T]) PathIterator(path []byte) *PathIterator[T] {
-	return &PathIterator[T]{node: n, path: path}
+	return &PathIterator[T]{node: n, path: path, full: path}
 }
 
 // rawIterator is used to return a raw iterator at the given node to walk the
@@ -240,21 +333,36 @@ func (n *Node[T]) rawIterator() *rawIterator[T] {
 
 // Walk is used to walk the tree
 func (n *Node[T]) Walk(fn WalkFn[T]) {
+	if n.isCompact() {
+		compactWalk(n, nil, false, fn)
+		return
+	}
 	recursiveWalk(n, fn)
 }
 
 // WalkBackwards is used to walk the tree in reverse order
 func (n *Node[T]) WalkBackwards(fn WalkFn[T]) {
+	if n.isCompact() {
+		compactWalk(n, nil, true, fn)
+		return
+	}
 	reverseRecursiveWalk(n, fn)
 }
 
 // WalkPrefix is used to walk the tree under a prefix
 func (n *Node[T]) WalkPrefix(prefix []byte, fn WalkFn[T]) {
 	search := prefix
+	walk := func(n *Node[T], parent []byte) {
+		if n.isCompact() {
+			compactWalk(n, append([]byte(nil), parent...), false, fn)
+			return
+		}
+		recursiveWalk(n, fn)
+	}
 	for {
 		// Check for key exhaustion
 		if len(search) == 0 {
-			recursiveWalk(n, fn)
+			walk(n, prefix[:len(prefix)-len(n.prefix)])
 			return
 		}
 
@@ -270,7 +378,7 @@ func (n *Node[T]) WalkPrefix(prefix []byte, fn WalkFn[T]) {
 
 		} else if bytes.HasPrefix(n.prefix, search) {
 			// Child may be under our search prefix
-			recursiveWalk(n, fn)
+			walk(n, prefix[:len(prefix)-len(search)])
 			return
 		} else {
 			break
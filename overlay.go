@@ -0,0 +1,225 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+// Overlay presents a base tree plus a small layer of changes as a single
+// view, without modifying the base. The change layer holds inserted entries,
+// which shadow the base, along with tombstones for single keys and for whole
+// prefixes, which hide base entries. It is meant for speculative work on top
+// of a large tree, where the changes are usually thrown away but can be
+// merged into a new tree with Flatten.
+//
+// An Overlay is not thread safe, and like Txn.Root, iterators obtained from
+// it are not safe across Insert, Delete and DeletePrefix calls.
+type Overlay[T any] struct {
+	base *Tree[T]
+
+	// puts holds the inserted entries.
+	puts *Txn[T]
+
+	// tombs and prefixTombs hold the deleted keys and prefixes. They only
+	// ever hide base entries, since deleting from the overlay also removes
+	// any matching entries from puts.
+	tombs       *Txn[struct{}]
+	prefixTombs *Txn[struct{}]
+}
+
+// NewOverlay returns an Overlay with no changes on top of base.
+func NewOverlay[T any](base *Tree[T]) *Overlay[T] {
+	return &Overlay[T]{
+		base:        base,
+		puts:        New[T]().Txn(),
+		tombs:       New[struct{}]().Txn(),
+		prefixTombs: New[struct{}]().Txn(),
+	}
+}
+
+// Base returns the tree underneath the overlay.
+func (o *Overlay[T]) Base() *Tree[T] {
+	return o.base
+}
+
+// Insert adds or updates a key in the change layer.
+func (o *Overlay[T]) Insert(k []byte, v T) {
+	o.puts.Insert(k, v)
+	o.tombs.Delete(k)
+}
+
+// Delete hides a key, whether it was inserted into the overlay or is in the
+// base.
+func (o *Overlay[T]) Delete(k []byte) {
+	o.puts.Delete(k)
+	o.tombs.Insert(k, struct{}{})
+}
+
+// DeletePrefix hides every key under the given prefix, whether it was
+// inserted into the overlay or is in the base. Keys inserted afterwards are
+// visible again.
+func (o *Overlay[T]) DeletePrefix(prefix []byte) {
+	o.puts.DeletePrefix(prefix)
+	o.tombs.DeletePrefix(prefix)
+	o.prefixTombs.Insert(prefix, struct{}{})
+}
+
+// hidden returns true if a base entry for k is covered by a tombstone.
+func (o *Overlay[T]) hidden(k []byte) bool {
+	if _, ok := o.tombs.Root().Get(k); ok {
+		return true
+	}
+	_, _, ok := o.prefixTombs.Root().LongestPrefix(k)
+	return ok
+}
+
+// Get is used to lookup a specific key, returning the value and if it was
+// found.
+func (o *Overlay[T]) Get(k []byte) (T, bool) {
+	if v, ok := o.puts.Root().Get(k); ok {
+		return v, true
+	}
+	if o.hidden(k) {
+		var zero T
+		return zero, false
+	}
+	return o.base.Get(k)
+}
+
+// LongestPrefix is like Get, but instead of an exact match, it will return
+// the longest prefix match.
+func (o *Overlay[T]) LongestPrefix(k []byte) ([]byte, T, bool) {
+	pk, pv, pok := o.puts.Root().LongestPrefix(k)
+
+	// The base's longest match may be hidden, so look at every base key
+	// along the path and keep the last visible one.
+	var bk []byte
+	var bv T
+	var bok bool
+	o.base.Root().WalkPath(k, func(k []byte, v T) bool {
+		if !o.hidden(k) {
+			bk, bv, bok = k, v, true
+		}
+		return false
+	})
+
+	if pok && (!bok || len(pk) >= len(bk)) {
+		return pk, pv, true
+	}
+	return bk, bv, bok
+}
+
+// WalkPrefix is used to walk the visible entries under a prefix in order.
+func (o *Overlay[T]) WalkPrefix(prefix []byte, fn WalkFn[T]) {
+	iter := o.Iterator()
+	iter.SeekPrefix(prefix)
+	for k, v, ok := iter.Next(); ok; k, v, ok = iter.Next() {
+		if fn(k, v) {
+			return
+		}
+	}
+}
+
+// Flatten returns a new tree with the changes applied to the base.
+func (o *Overlay[T]) Flatten() *Tree[T] {
+	txn := o.base.Txn()
+	o.prefixTombs.Root().Walk(func(k []byte, _ struct{}) bool {
+		txn.DeletePrefix(k)
+		return false
+	})
+	o.tombs.Root().Walk(func(k []byte, _ struct{}) bool {
+		txn.Delete(k)
+		return false
+	})
+	o.puts.Root().Walk(func(k []byte, v T) bool {
+		txn.Insert(k, v)
+		return false
+	})
+	return txn.Commit()
+}
+
+// visible wraps the next function of a base iterator so that it skips the
+// entries hidden by tombstones.
+func (o *Overlay[T]) visible(next func() ([]byte, T, bool)) func() ([]byte, T, bool) {
+	return func() ([]byte, T, bool) {
+		for {
+			k, v, ok := next()
+			if !ok || !o.hidden(k) {
+				return k, v, ok
+			}
+		}
+	}
+}
+
+// OverlayIterator iterates over the visible entries of an Overlay in order.
+type OverlayIterator[T any] struct {
+	put, base *Iterator[T]
+	m         merger[T]
+}
+
+// Iterator returns an iterator over the visible entries of the overlay.
+func (o *Overlay[T]) Iterator() *OverlayIterator[T] {
+	i := &OverlayIterator[T]{
+		put:  o.puts.Root().Iterator(),
+		base: o.base.Root().Iterator(),
+	}
+	// The change layer is the first source, so it wins on equal keys.
+	i.m = newMerger(MergeFirstWins, false, []func() ([]byte, T, bool){i.put.Next, o.visible(i.base.Next)})
+	return i
+}
+
+// SeekPrefix is used to seek the iterator to a given prefix.
+func (i *OverlayIterator[T]) SeekPrefix(prefix []byte) {
+	i.put.SeekPrefix(prefix)
+	i.base.SeekPrefix(prefix)
+	i.m.reset()
+}
+
+// SeekLowerBound is used to seek the iterator to the smallest key that is
+// greater or equal to the given key.
+func (i *OverlayIterator[T]) SeekLowerBound(key []byte) {
+	i.put.SeekLowerBound(key)
+	i.base.SeekLowerBound(key)
+	i.m.reset()
+}
+
+// Next returns the next visible entry in order.
+func (i *OverlayIterator[T]) Next() ([]byte, T, bool) {
+	return i.m.next()
+}
+
+// OverlayReverseIterator iterates over the visible entries of an Overlay in
+// reverse order.
+type OverlayReverseIterator[T any] struct {
+	put, base *ReverseIterator[T]
+	m         merger[T]
+}
+
+// ReverseIterator returns a reverse iterator over the visible entries of
+// the overlay.
+func (o *Overlay[T]) ReverseIterator() *OverlayReverseIterator[T] {
+	i := &OverlayReverseIterator[T]{
+		put:  o.puts.Root().ReverseIterator(),
+		base: o.base.Root().ReverseIterator(),
+	}
+	i.m = newMerger(MergeFirstWins, true, []func() ([]byte, T, bool){i.put.Previous, o.visible(i.base.Previous)})
+	return i
+}
+
+// SeekPrefix is used to seek the iterator to a given prefix.
+func (i *OverlayReverseIterator[T]) SeekPrefix(prefix []byte) {
+	i.put.SeekPrefix(prefix)
+	i.base.SeekPrefix(prefix)
+	i.m.reset()
+}
+
+// SeekReverseLowerBound is used to seek the iterator to the largest key
+// that is lower or equal to the given key.
+func (i *OverlayReverseIterator[T]) SeekReverseLowerBound(key []byte) {
+	i.put.SeekReverseLowerBound(key)
+	i.base.SeekReverseLowerBound(key)
+	i.m.reset()
+}
+
+// Previous returns the previous visible entry in reverse order.
+func (i *OverlayReverseIterator[T]) Previous() ([]byte, T, bool) {
+	return i.m.next()
+}
@@ -0,0 +1,149 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func overlayFixture() *Overlay[string] {
+	txn := New[string]().Txn()
+	for _, k := range []string{"a", "ab", "abc", "b", "foo/1", "foo/2", "foo/3", "z"} {
+		txn.Insert([]byte(k), "base-"+k)
+	}
+	o := NewOverlay(txn.Commit())
+	o.Insert([]byte("ab"), "new-ab")
+	o.Insert([]byte("c"), "new-c")
+	o.Delete([]byte("abc"))
+	o.Delete([]byte("z"))
+	o.DeletePrefix([]byte("foo/"))
+	o.Insert([]byte("foo/2"), "new-foo/2")
+	return o
+}
+
+func TestOverlay_Get(t *testing.T) {
+	o := overlayFixture()
+	cases := map[string]string{
+		"a":     "base-a",
+		"ab":    "new-ab",
+		"abc":   "",
+		"b":     "base-b",
+		"c":     "new-c",
+		"foo/1": "",
+		"foo/2": "new-foo/2",
+		"z":     "",
+	}
+	for k, want := range cases {
+		v, ok := o.Get([]byte(k))
+		if ok != (want != "") || v != want {
+			t.Fatalf("bad %q: %q %v", k, v, ok)
+		}
+	}
+
+	// The base is untouched.
+	if v, ok := o.Base().Get([]byte("abc")); !ok || v != "base-abc" {
+		t.Fatalf("bad: %v", v)
+	}
+
+	// Inserting again after a delete brings the key back.
+	o.Insert([]byte("z"), "new-z")
+	if v, ok := o.Get([]byte("z")); !ok || v != "new-z" {
+		t.Fatalf("bad: %v", v)
+	}
+}
+
+func TestOverlay_LongestPrefix(t *testing.T) {
+	o := overlayFixture()
+	cases := map[string]string{
+		"abcd":   "ab",
+		"abc":    "ab",
+		"a":      "a",
+		"foo/1x": "",
+		"foo/2x": "foo/2",
+		"cat":    "c",
+	}
+	for k, want := range cases {
+		m, _, ok := o.LongestPrefix([]byte(k))
+		if ok != (want != "") || string(m) != want {
+			t.Fatalf("bad %q: %q %v", k, m, ok)
+		}
+	}
+
+	// A hidden base key gives way to a shorter visible one.
+	o.Delete([]byte("ab"))
+	if m, v, ok := o.LongestPrefix([]byte("abcd")); !ok || string(m) != "a" || v != "base-a" {
+		t.Fatalf("bad: %q %v", m, v)
+	}
+}
+
+func TestOverlay_Iterators(t *testing.T) {
+	o := overlayFixture()
+	want := []string{"a", "ab", "b", "c", "foo/2"}
+
+	var keys []string
+	iter := o.Iterator()
+	for k, _, ok := iter.Next(); ok; k, _, ok = iter.Next() {
+		keys = append(keys, string(k))
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	keys = nil
+	riter := o.ReverseIterator()
+	for k, _, ok := riter.Previous(); ok; k, _, ok = riter.Previous() {
+		keys = append([]string{string(k)}, keys...)
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	iter = o.Iterator()
+	iter.SeekLowerBound([]byte("abb"))
+	if k, _, _ := iter.Next(); string(k) != "b" {
+		t.Fatalf("bad: %q", k)
+	}
+	riter = o.ReverseIterator()
+	riter.SeekReverseLowerBound([]byte("bz"))
+	if k, _, _ := riter.Previous(); string(k) != "b" {
+		t.Fatalf("bad: %q", k)
+	}
+	riter = o.ReverseIterator()
+	riter.SeekPrefix([]byte("a"))
+	if k, v, _ := riter.Previous(); string(k) != "ab" || v != "new-ab" {
+		t.Fatalf("bad: %q %v", k, v)
+	}
+
+	keys = nil
+	o.WalkPrefix([]byte("foo/"), func(k []byte, _ string) bool {
+		keys = append(keys, string(k))
+		return false
+	})
+	if !reflect.DeepEqual(keys, []string{"foo/2"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+}
+
+func TestOverlay_Flatten(t *testing.T) {
+	o := overlayFixture()
+	r := o.Flatten()
+
+	var got []string
+	iter := o.Iterator()
+	for k, v, ok := iter.Next(); ok; k, v, ok = iter.Next() {
+		got = append(got, string(k)+"="+v)
+	}
+	var flat []string
+	r.Root().Walk(func(k []byte, v string) bool {
+		flat = append(flat, string(k)+"="+v)
+		return false
+	})
+	if !reflect.DeepEqual(got, flat) {
+		t.Fatalf("bad: %v != %v", got, flat)
+	}
+	if r.Len() != len(flat) {
+		t.Fatalf("bad len: %d", r.Len())
+	}
+}
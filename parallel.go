@@ -0,0 +1,478 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// TxnOp is a single Insert or Delete applied by Txn.ApplyParallel.
+type TxnOp[T any] struct {
+	Key    []byte
+	Val    T
+	Delete bool
+}
+
+// opPartition is the part of a batch that goes under one edge of the node
+// the batch is split at, along with what applying it produced.
+type opPartition[T any] struct {
+	label byte
+	idxs  []int
+
+	// child is the new node under the edge, or nil if it was removed, and
+	// txn is the transaction that built it.
+	child *Node[T]
+	txn   *Txn[T]
+}
+
+// ApplyParallel applies a batch of operations to the transaction using up to
+// the given number of goroutines, or GOMAXPROCS if workers is less than 1.
+// The result is the same as applying the operations in order with Insert and
+// Delete, including what is written to the log, recorded for Rebase and
+// notified on commit.
+//
+// The batch is split below the deepest node whose path all of its keys
+// start with, by the next byte of each key, so every worker changes a
+// separate subtree and the subtrees are then put back under new copies of
+// the nodes above them. Operations on keys that share that byte are applied
+// by the same worker, in order, so a batch whose keys all continue the same
+// way below that node is applied on a single goroutine.
+func (t *Txn[T]) ApplyParallel(ops []TxnOp[T], workers int) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers == 1 || len(ops) < 2 {
+		t.applySequential(ops)
+		return
+	}
+
+	// Find the deepest node whose path is a prefix of every key, along with
+	// the nodes above it and the labels of the edges leading to it.
+	common := ops[0].Key
+	for _, op := range ops[1:] {
+		common = common[:longestPrefix(common, op.Key)]
+	}
+	var (
+		parents []*Node[T]
+		labels  []byte
+	)
+	n, depth := t.root, 0
+	for depth < len(common) {
+		_, child := n.getEdge(common[depth])
+		if child == nil || !bytes.HasPrefix(common[depth:], child.prefix) {
+			break
+		}
+		parents = append(parents, n)
+		labels = append(labels, common[depth])
+		n, depth = child, depth+len(child.prefix)
+	}
+
+	// Group the operations by the edge they go under. Keys that end at the
+	// node itself only change its leaf, and are applied once the rest are
+	// done.
+	var (
+		byLabel [256]*opPartition[T]
+		parts   []*opPartition[T]
+		here    []int
+	)
+	for i, op := range ops {
+		if len(op.Key) == depth {
+			here = append(here, i)
+			continue
+		}
+		label := op.Key[depth]
+		p := byLabel[label]
+		if p == nil {
+			p = &opPartition[T]{label: label}
+			byLabel[label] = p
+			parts = append(parts, p)
+		}
+		p.idxs = append(p.idxs, i)
+	}
+	if len(parts) < 2 {
+		t.applySequential(ops)
+		return
+	}
+
+	// Hand out the largest partitions first so that the workers finish at
+	// about the same time.
+	sort.Slice(parts, func(i, j int) bool {
+		return len(parts[i].idxs) > len(parts[j].idxs)
+	})
+	if workers > len(parts) {
+		workers = len(parts)
+	}
+	existed := make([]bool, len(ops))
+	work := make(chan *opPartition[T], len(parts))
+	for _, p := range parts {
+		work <- p
+	}
+	close(work)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for p := range work {
+				t.applyPartition(n, depth, p, ops, existed)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Collect what the workers changed. If none of the subtrees changed,
+	// the nodes above them are left alone, like they are by a Delete of a
+	// missing key.
+	changed := false
+	for _, p := range parts {
+		if _, old := n.getEdge(p.label); old != p.child {
+			changed = true
+		}
+		t.size += p.txn.size
+		if p.txn.trackOverflow {
+			t.trackOverflow = true
+			t.trackChannels = nil
+		}
+		for ch := range p.txn.trackChannels {
+			t.trackChannel(ch)
+		}
+	}
+
+	if changed {
+		t.stitch(n, parents, labels, parts)
+	}
+	t.applyOps(ops, here, 0, existed)
+	t.recordOps(ops, existed)
+}
+
+// stitch puts the new subtrees built for the partitions under a copy of n,
+// and copies the parents above it, given the labels of the edges leading
+// to n.
+func (t *Txn[T]) stitch(n *Node[T], parents []*Node[T], labels []byte, parts []*opPartition[T]) {
+	nc := t.writeNode(n, false)
+	for _, p := range parts {
+		idx, old := nc.getEdge(p.label)
+		switch {
+		case p.child == nil:
+			if old != nil {
+				nc.delEdge(p.label)
+			}
+		case old == nil:
+			nc.addEdge(edge[T]{label: p.label, node: p.child})
+		default:
+			nc.edges[idx].node = p.child
+		}
+	}
+
+	// Fix up the node if it's left without a leaf and with fewer than two
+	// edges, the same way Delete does, and copy the nodes above it.
+	child := nc
+	if n != t.root && nc.leaf == nil {
+		switch len(nc.edges) {
+		case 0:
+			child = nil
+		case 1:
+			t.mergeChild(nc)
+		}
+	}
+	for i := len(parents) - 1; i >= 0; i-- {
+		pc := t.writeNode(parents[i], false)
+		if child == nil {
+			pc.delEdge(labels[i])
+			if parents[i] != t.root && len(pc.edges) == 1 && !pc.isLeaf() {
+				t.mergeChild(pc)
+			}
+		} else {
+			idx, _ := pc.getEdge(labels[i])
+			pc.edges[idx].node = child
+		}
+		child = pc
+	}
+	t.root = child
+}
+
+// applySequential applies the operations one at a time.
+func (t *Txn[T]) applySequential(ops []TxnOp[T]) {
+	for _, op := range ops {
+		if op.Delete {
+			t.Delete(op.Key)
+		} else {
+			t.Insert(op.Key, op.Val)
+		}
+	}
+}
+
+// applyPartition applies the operations of a partition in a transaction of
+// its own, whose root only has the edge the partition goes under, given the
+// node it's under and the length of the path to it.
+func (t *Txn[T]) applyPartition(n *Node[T], depth int, p *opPartition[T], ops []TxnOp[T], existed []bool) {
+	root := &Node[T]{}
+	if _, child := n.getEdge(p.label); child != nil {
+		root.edges = edges[T]{{label: p.label, node: child}}
+	}
+
+	// The root is never visible outside, so it's writable from the start,
+	// and never tracked.
+	writable := newWritable[T]()
+	writable.Add(root, nil)
+
+	txn := &Txn[T]{
+		root:           root,
+		writable:       writable,
+		compact:        t.compact,
+		trackMutate:    t.trackMutate,
+		parentWritable: t.writable,
+	}
+	if t.arena != nil {
+		txn.arena = &txnArena[T]{}
+	}
+	txn.applyOps(ops, p.idxs, depth, existed)
+	txn.sealWritable()
+
+	_, p.child = txn.root.getEdge(p.label)
+	p.txn = txn
+}
+
+// applyOps applies the operations at the given indexes, whose keys all start
+// with the path to the transaction's root, which is depth bytes long. It
+// records in existed whether each key was set beforehand, and doesn't log or
+// record the operations.
+func (t *Txn[T]) applyOps(ops []TxnOp[T], idxs []int, depth int, existed []bool) {
+	for _, i := range idxs {
+		op := ops[i]
+		if op.Delete {
+			newRoot, leaf := t.delete(t.root, op.Key[depth:])
+			if newRoot != nil {
+				t.root = newRoot
+			}
+			if leaf != nil {
+				t.size--
+				existed[i] = true
+			}
+			continue
+		}
+		k := t.ownKey(op.Key)
+		newRoot, _, didUpdate := t.insert(t.root, k, k[depth:], op.Val)
+		if newRoot != nil {
+			t.root = newRoot
+		}
+		if !didUpdate {
+			t.size++
+		}
+		existed[i] = didUpdate
+	}
+}
+
+// recordOps writes the operations to the log and records them for Rebase,
+// the same way Insert and Delete do, given whether each key was set
+// beforehand.
+func (t *Txn[T]) recordOps(ops []TxnOp[T], existed []bool) {
+	for i, op := range ops {
+		if op.Delete {
+			if t.log != nil && existed[i] {
+				t.log.write(walDelete, op.Key, nil)
+			}
+			if t.trackOps {
+				t.ops = append(t.ops, txnOp[T]{kind: walDelete, key: append([]byte(nil), op.Key...)})
+			}
+			continue
+		}
+		if t.log != nil {
+			t.log.insert(op.Key, op.Val)
+		}
+		if t.trackOps {
+			t.ops = append(t.ops, txnOp[T]{kind: walInsert, key: append([]byte(nil), op.Key...), val: op.Val})
+		}
+	}
+}
+
+// isParentWritable returns true if n is writable by the transaction that
+// started this one, see ApplyParallel.
+func (t *Txn[T]) isParentWritable(n *Node[T]) bool {
+	return t.parentWritable != nil && t.parentWritable.Contains(n)
+}
+
+// chunksPerWorker is how many chunks ParallelWalk aims to split the tree
+// into for each worker. Workers take the next chunk when they finish one,
+// so having more chunks than workers evens out chunks of different sizes.
+const chunksPerWorker = 16
+
+// walkCheckInterval is how many leaves ParallelWalk visits between checks of
+// its context.
+const walkCheckInterval = 64
+
+// ParallelWalkFn is called by ParallelWalk for each leaf, with the index of
+// the chunk of the tree the leaf is in. Returning an error stops the walk.
+type ParallelWalkFn[T any] func(chunk int, k []byte, v T) error
+
+// walkChunk is a part of the tree visited by ParallelWalk: a whole subtree,
+// or just the leaf of a node whose children are in chunks of their own.
+// For compact trees, path is the path to the parent of the node.
+type walkChunk[T any] struct {
+	node     *Node[T]
+	path     []byte
+	leafOnly bool
+}
+
+// ParallelWalk walks the tree using up to the given number of goroutines, or
+// GOMAXPROCS if workers is less than 1. The tree is split at internal nodes
+// into chunks, which are numbered in key order, so every key in a chunk
+// sorts before the keys in the chunks after it. The leaves of a chunk are
+// passed to fn in key order, one at a time, so output collected per chunk
+// index and put together by index is in the same order as Walk. Leaves in
+// different chunks are passed to fn concurrently.
+//
+// The walk stops at the first error returned by fn, which is returned, or
+// when ctx is done, in which case the context's error is returned.
+func (n *Node[T]) ParallelWalk(ctx context.Context, workers int, fn ParallelWalkFn[T]) error {
+	return walkParallel(ctx, n, nil, n.isCompact(), workers, fn)
+}
+
+// ParallelWalkPrefix is like ParallelWalk, but only walks the leaves under
+// the given prefix. It seeks to the node the prefix leads to, and splits the
+// tree below it into chunks.
+func (n *Node[T]) ParallelWalkPrefix(ctx context.Context, prefix []byte, workers int, fn ParallelWalkFn[T]) error {
+	compact := n.isCompact()
+	n, rest := seekNode(n, prefix)
+	if n == nil {
+		return ctx.Err()
+	}
+
+	// Compact trees need the path to the parent of the node, which is the
+	// prefix plus the rest of the node's path, less the node's own prefix.
+	var parent []byte
+	if compact {
+		path := append(append([]byte(nil), prefix...), rest...)
+		parent = path[:len(path)-len(n.prefix)]
+	}
+	return walkParallel(ctx, n, parent, compact, workers, fn)
+}
+
+// walkParallel walks the tree under n for ParallelWalk and
+// ParallelWalkPrefix. For compact trees, parent is the path to the parent
+// of n.
+func walkParallel[T any](ctx context.Context, n *Node[T], parent []byte, compact bool, workers int, fn ParallelWalkFn[T]) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	chunks := n.walkChunks(workers*chunksPerWorker, parent, compact)
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+
+	// stopped is set once the first error is recorded, which the workers
+	// check before every leaf. The context is checked less often, since
+	// that's slower.
+	var (
+		stopped  int32
+		firstErr error
+		errOnce  sync.Once
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			atomic.StoreInt32(&stopped, 1)
+		})
+	}
+	done := ctx.Done()
+	cancelled := func() bool {
+		select {
+		case <-done:
+			fail(ctx.Err())
+			return true
+		default:
+			return atomic.LoadInt32(&stopped) != 0
+		}
+	}
+
+	var next int64 = -1
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(chunks) || cancelled() {
+					return
+				}
+				leaves := 0
+				chunks[i].walk(compact, func(k []byte, v T) bool {
+					leaves++
+					if atomic.LoadInt32(&stopped) != 0 || leaves%walkCheckInterval == 0 && cancelled() {
+						return true
+					}
+					if err := fn(i, k, v); err != nil {
+						fail(err)
+						return true
+					}
+					return false
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// walkChunks splits the tree into at least the given number of chunks in
+// key order, if it has enough nodes, by splitting every chunk that has
+// children one level at a time. Paths are only tracked for compact trees,
+// starting from parent, the path to the parent of n.
+func (n *Node[T]) walkChunks(target int, parent []byte, compact bool) []walkChunk[T] {
+	chunks := []walkChunk[T]{{node: n, path: parent}}
+	for len(chunks) < target {
+		var split []walkChunk[T]
+		didSplit := false
+		for _, c := range chunks {
+			if c.leafOnly || len(c.node.edges) == 0 {
+				split = append(split, c)
+				continue
+			}
+			didSplit = true
+			var path []byte
+			if compact {
+				path = concat(c.path, c.node.prefix)
+			}
+			if c.node.leaf != nil {
+				split = append(split, walkChunk[T]{node: c.node, path: c.path, leafOnly: true})
+			}
+			for _, e := range c.node.edges {
+				split = append(split, walkChunk[T]{node: e.node, path: path})
+			}
+		}
+		if !didSplit {
+			break
+		}
+		chunks = split
+	}
+	return chunks
+}
+
+// walk calls fn for each leaf in the chunk in key order, stopping when it
+// returns true.
+func (c *walkChunk[T]) walk(compact bool, fn WalkFn[T]) {
+	n := c.node
+	switch {
+	case c.leafOnly:
+		var path []byte
+		if compact {
+			path = concat(c.path, n.prefix)
+		}
+		fn(n.leaf.keyAt(path), n.leaf.val)
+	case compact:
+		// Copy the path, since the walk appends to it.
+		compactWalk(n, append([]byte(nil), c.path...), false, fn)
+	default:
+		recursiveWalk(n, fn)
+	}
+}
@@ -0,0 +1,537 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// parallelOps returns a random batch of inserts and deletes over keys with
+// a shared prefix, with repeats of the same key. Some keys are cut short so
+// that they end on the node the batch is split at, or above the node a
+// worker starts from.
+func parallelOps(rnd *rand.Rand, n int) []TxnOp[int] {
+	const shared = len("/registry/")
+	ops := make([]TxnOp[int], n)
+	for i := range ops {
+		k := []byte(fmt.Sprintf("/registry/%c/%d", "abcdefgh"[rnd.Intn(8)], rnd.Intn(n)))
+		if rnd.Intn(10) == 0 {
+			k = k[:shared+rnd.Intn(len(k)-shared)]
+		}
+		ops[i] = TxnOp[int]{Key: k, Val: i, Delete: rnd.Intn(3) == 0}
+	}
+	return ops
+}
+
+// parallelBase returns a tree with keys that the ops from parallelOps
+// overlap with.
+func parallelBase(rnd *rand.Rand, n int, opts ...Option) *Tree[int] {
+	txn := New[int](opts...).Txn()
+	for i := 0; i < n; i++ {
+		txn.Insert([]byte(fmt.Sprintf("/registry/%c/%d", "abcdefgh"[rnd.Intn(8)], rnd.Intn(n))), -i)
+	}
+	return txn.Commit()
+}
+
+// checkNormal fails if a node below the root has neither a leaf nor more
+// than one edge, which the tree never leaves behind.
+func checkNormal[T any](t *testing.T, n *Node[T], root bool) {
+	t.Helper()
+	if !root && n.leaf == nil && len(n.edges) < 2 {
+		t.Fatalf("bad: node %q has no leaf and %d edges", n.prefix, len(n.edges))
+	}
+	for _, e := range n.edges {
+		if len(e.node.prefix) == 0 || e.node.prefix[0] != e.label {
+			t.Fatalf("bad: edge %q has prefix %q", e.label, e.node.prefix)
+		}
+		checkNormal(t, e.node, false)
+	}
+}
+
+func TestTxn_ApplyParallel(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		var opts []Option
+		if compact {
+			opts = append(opts, CompactKeys())
+		}
+		for seed := int64(0); seed < 20; seed++ {
+			for _, workers := range []int{0, 1, 3, 16} {
+				rnd := rand.New(rand.NewSource(seed))
+				base := parallelBase(rnd, 500, opts...)
+				ops := parallelOps(rnd, 1000)
+				before := parallelOps(rnd, 50)
+
+				wantTxn := base.Txn()
+				wantTxn.applySequential(before)
+				wantTxn.applySequential(ops)
+				want := wantTxn.Commit()
+
+				// Changes made earlier in the transaction leave writable
+				// nodes behind that the workers write in place.
+				txn := base.Txn()
+				txn.applySequential(before)
+				txn.ApplyParallel(ops, workers)
+
+				got := txn.Commit()
+				checkNormal(t, got.Root(), true)
+				if got.Len() != want.Len() {
+					t.Fatalf("bad: seed %d workers %d len %d %d", seed, workers, got.Len(), want.Len())
+				}
+				if w, g := collectWalk(want.Root().Walk), collectWalk(got.Root().Walk); !reflect.DeepEqual(w, g) {
+					t.Fatalf("bad: seed %d workers %d\nwant %v\ngot  %v", seed, workers, w, g)
+				}
+				if got.compact != compact || got.Root().isCompact() != compact {
+					t.Fatalf("bad: compact flag")
+				}
+				if w, g := collectWalk(parallelBase(rand.New(rand.NewSource(seed)), 500).Root().Walk), collectWalk(base.Root().Walk); !reflect.DeepEqual(w, g) {
+					t.Fatalf("bad: base tree was modified")
+				}
+			}
+		}
+	}
+}
+
+func TestTxn_ApplyParallel_Delete(t *testing.T) {
+	cases := []struct {
+		keys    []string
+		deletes []string
+		want    []kv
+	}{
+		{
+			// The node the batch is split at loses its edges, and is
+			// removed from the root.
+			[]string{"/a/1", "/a/2", "/b/1", "/b/2", "x"},
+			[]string{"/a/1", "/a/2", "/b/1", "/b/2"},
+			[]kv{{"x", 1}},
+		},
+		{
+			// The node the batch is split at is left with one edge, and is
+			// merged with it.
+			[]string{"/a/1", "/a/2", "/b/1", "/b/2", "/c"},
+			[]string{"/a/1", "/a/2", "/b/1", "/b/2"},
+			[]kv{{"/c", 1}},
+		},
+		{
+			// The node the batch is split at is removed, and its parent is
+			// merged with the edge it has left.
+			[]string{"/p/a/1", "/p/a/2", "/p/b", "/q"},
+			[]string{"/p/a/1", "/p/a/2"},
+			[]kv{{"/p/b", 1}, {"/q", 1}},
+		},
+		{
+			// The leaf of the node the batch is split at goes last.
+			[]string{"/a/1", "/a/2", "/b/1", "/b/2", "/", "x"},
+			[]string{"/a/1", "/a/2", "/b/1", "/b/2", "/"},
+			[]kv{{"x", 1}},
+		},
+	}
+	for i, c := range cases {
+		r := New[int]()
+		for _, k := range c.keys {
+			r, _, _ = r.Insert([]byte(k), 1)
+		}
+		var ops []TxnOp[int]
+		for _, k := range c.deletes {
+			ops = append(ops, TxnOp[int]{Key: []byte(k), Delete: true})
+		}
+
+		txn := r.Txn()
+		txn.ApplyParallel(ops, 4)
+		r = txn.Commit()
+		checkNormal(t, r.Root(), true)
+		if got := collectWalk(r.Root().Walk); !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("bad: case %d %v", i, got)
+		}
+		if r.Len() != len(c.want) {
+			t.Fatalf("bad: case %d %d", i, r.Len())
+		}
+	}
+}
+
+func TestTxn_ApplyParallel_LogAndOps(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	var base *Tree[string]
+	{
+		txn := New[string]().Txn()
+		for i := 0; i < 200; i++ {
+			txn.Insert([]byte(fmt.Sprintf("%c/%d", 'a'+rnd.Intn(8), rnd.Intn(200))), "base")
+		}
+		base = txn.Commit()
+	}
+	var ops []TxnOp[string]
+	for _, op := range parallelOps(rnd, 500) {
+		k := []byte(fmt.Sprintf("%c/%d", 'a'+rnd.Intn(8), rnd.Intn(200)))
+		ops = append(ops, TxnOp[string]{Key: k, Val: fmt.Sprint(op.Val), Delete: op.Delete})
+	}
+
+	var wantLog, gotLog bytes.Buffer
+	want, got := base.Txn(), base.Txn()
+	want.SetLog(&wantLog, stringCodec{})
+	got.SetLog(&gotLog, stringCodec{})
+	want.TrackOps(true)
+	got.TrackOps(true)
+	want.applySequential(ops)
+	got.ApplyParallel(ops, 4)
+	if !reflect.DeepEqual(want.ops, got.ops) {
+		t.Fatalf("bad: recorded ops differ")
+	}
+	want.Commit()
+	got.Commit()
+	if !bytes.Equal(wantLog.Bytes(), gotLog.Bytes()) {
+		t.Fatalf("bad: logs differ")
+	}
+}
+
+// watchChannels returns the watch channels of every node and leaf in the
+// tree, in iteration order.
+func watchChannels[T any](n *Node[T]) []chan struct{} {
+	var chs []chan struct{}
+	for iter := n.rawIterator(); iter.Front() != nil; iter.Next() {
+		elem := iter.Front()
+		chs = append(chs, elem.mutateCh.get())
+		if elem.leaf != nil {
+			chs = append(chs, elem.leaf.mutateCh.get())
+		}
+	}
+	return chs
+}
+
+func TestTxn_ApplyParallel_TrackMutate(t *testing.T) {
+	// The small batch tracks channels one by one, and the large one
+	// overflows into the slow notify.
+	for _, n := range []int{100, 20000} {
+		// Build the same tree twice, so that it has the same structure but
+		// its own channels.
+		want := parallelBase(rand.New(rand.NewSource(2)), n)
+		got := parallelBase(rand.New(rand.NewSource(2)), n)
+		wantChs, gotChs := watchChannels(want.Root()), watchChannels(got.Root())
+		if len(wantChs) != len(gotChs) {
+			t.Fatalf("bad: %d %d", len(wantChs), len(gotChs))
+		}
+
+		ops := parallelOps(rand.New(rand.NewSource(3)), n)
+		wantTxn, gotTxn := want.Txn(), got.Txn()
+		wantTxn.TrackMutate(true)
+		gotTxn.TrackMutate(true)
+		wantTxn.applySequential(ops)
+		gotTxn.ApplyParallel(ops, 4)
+		if wantTxn.trackOverflow != gotTxn.trackOverflow {
+			t.Fatalf("bad: overflow %v %v", wantTxn.trackOverflow, gotTxn.trackOverflow)
+		}
+		wantTxn.Commit()
+		gotTxn.Commit()
+
+		closed := 0
+		for i := range wantChs {
+			if isClosed(wantChs[i]) != isClosed(gotChs[i]) {
+				t.Fatalf("bad: %d channel %d closed %v %v", n, i, isClosed(wantChs[i]), isClosed(gotChs[i]))
+			}
+			if isClosed(wantChs[i]) {
+				closed++
+			}
+		}
+		if closed == 0 || closed == len(wantChs) {
+			t.Fatalf("bad: %d of %d closed", closed, len(wantChs))
+		}
+	}
+}
+
+func TestTxn_ApplyParallel_UseArena(t *testing.T) {
+	rnd := rand.New(rand.NewSource(4))
+	base := parallelBase(rnd, 1000)
+	ops := parallelOps(rnd, 5000)
+
+	wantTxn := base.Txn()
+	wantTxn.applySequential(ops)
+	want := wantTxn.Commit()
+	txn := base.Txn()
+	txn.UseArena(true)
+	txn.ApplyParallel(ops, 4)
+	got := txn.Commit()
+	checkNormal(t, got.Root(), true)
+	if w, g := collectWalk(want.Root().Walk), collectWalk(got.Root().Walk); !reflect.DeepEqual(w, g) {
+		t.Fatalf("bad: contents differ")
+	}
+}
+
+// benchmarkApply applies a batch of inserts over keys that all share a
+// prefix to a tree.
+func benchmarkApply(b *testing.B, apply func(txn *Txn[int], ops []TxnOp[int])) {
+	base := New[int]().Txn()
+	for i := 0; i < 100000; i++ {
+		base.Insert([]byte(fmt.Sprintf("/registry/services/%08d", i*7919%100000)), i)
+	}
+	r := base.Commit()
+	ops := make([]TxnOp[int], 200000)
+	for i := range ops {
+		ops[i] = TxnOp[int]{Key: []byte(fmt.Sprintf("/registry/services/%08d", i*104729%200000)), Val: i}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		txn := r.Txn()
+		apply(txn, ops)
+		txn.Commit()
+	}
+}
+
+func BenchmarkApply_Sequential(b *testing.B) {
+	benchmarkApply(b, func(txn *Txn[int], ops []TxnOp[int]) {
+		txn.applySequential(ops)
+	})
+}
+
+func BenchmarkApply_Parallel(b *testing.B) {
+	benchmarkApply(b, func(txn *Txn[int], ops []TxnOp[int]) {
+		txn.ApplyParallel(ops, 0)
+	})
+}
+
+// parallelWalk collects the leaves passed to ParallelWalk by chunk, and puts
+// them together in chunk order.
+func parallelWalk(t *testing.T, n *Node[int], workers int) []kv {
+	out, _ := collectParallel(t, func(fn ParallelWalkFn[int]) error {
+		return n.ParallelWalk(context.Background(), workers, fn)
+	})
+	return out
+}
+
+// collectParallel is like parallelWalk for any parallel walk, and also
+// returns the number of chunks that had leaves.
+func collectParallel(t *testing.T, walk func(fn ParallelWalkFn[int]) error) ([]kv, int) {
+	var (
+		l       sync.Mutex
+		byChunk = make(map[int][]kv)
+	)
+	err := walk(func(chunk int, k []byte, v int) error {
+		l.Lock()
+		defer l.Unlock()
+		byChunk[chunk] = append(byChunk[chunk], kv{string(k), v})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var chunks []int
+	for c := range byChunk {
+		chunks = append(chunks, c)
+	}
+	sort.Ints(chunks)
+	var out []kv
+	for _, c := range chunks {
+		out = append(out, byChunk[c]...)
+	}
+	return out, len(chunks)
+}
+
+func TestNode_ParallelWalk(t *testing.T) {
+	for seed := int64(0); seed < 10; seed++ {
+		normal, compact, _ := compactPair(t, seed)
+		for _, r := range []*Tree[int]{normal, compact, parallelBase(rand.New(rand.NewSource(seed)), 2000)} {
+			want := collectWalk(r.Root().Walk)
+			for _, workers := range []int{0, 1, 3, 32} {
+				if got := parallelWalk(t, r.Root(), workers); !reflect.DeepEqual(got, want) {
+					t.Fatalf("bad: seed %d workers %d\nwant %v\ngot  %v", seed, workers, want, got)
+				}
+			}
+
+			// Walking part of the tree works the same way as Walk.
+			for _, e := range r.Root().edges {
+				want := collectWalk(e.node.Walk)
+				if got := parallelWalk(t, e.node, 4); !reflect.DeepEqual(got, want) {
+					t.Fatalf("bad: seed %d edge %q\nwant %v\ngot  %v", seed, e.label, want, got)
+				}
+			}
+		}
+	}
+
+	if got := parallelWalk(t, New[int]().Root(), 4); got != nil {
+		t.Fatalf("bad: %v", got)
+	}
+}
+
+func TestNode_ParallelWalkPrefix(t *testing.T) {
+	prefixes := []string{"", "/", "/reg", "/registry/", "/registry/a", "/registry/a/", "/registry/a/1", "/registry/z", "x"}
+	for seed := int64(0); seed < 5; seed++ {
+		normal, compact, keys := compactPair(t, seed)
+		rnd := rand.New(rand.NewSource(seed))
+		for _, k := range keys[:10] {
+			prefixes = append(prefixes, string(k[:rnd.Intn(len(k)+1)]))
+		}
+		trees := []*Tree[int]{
+			normal,
+			compact,
+			parallelBase(rand.New(rand.NewSource(seed)), 2000),
+			parallelBase(rand.New(rand.NewSource(seed)), 2000, CompactKeys()),
+		}
+		for _, r := range trees {
+			for _, prefix := range prefixes {
+				want := collectWalk(func(fn WalkFn[int]) {
+					r.Root().WalkPrefix([]byte(prefix), fn)
+				})
+				for _, workers := range []int{1, 4} {
+					got, _ := collectParallel(t, func(fn ParallelWalkFn[int]) error {
+						return r.Root().ParallelWalkPrefix(context.Background(), []byte(prefix), workers, fn)
+					})
+					if !reflect.DeepEqual(got, want) {
+						t.Fatalf("bad: seed %d prefix %q workers %d\nwant %v\ngot  %v", seed, prefix, workers, want, got)
+					}
+				}
+			}
+		}
+	}
+
+	// The part of the tree under the prefix is split into chunks.
+	r := parallelBase(rand.New(rand.NewSource(1)), 5000)
+	got, chunks := collectParallel(t, func(fn ParallelWalkFn[int]) error {
+		return r.Root().ParallelWalkPrefix(context.Background(), []byte("/registry/c/"), 4, fn)
+	})
+	if len(got) < 100 || chunks < 4*chunksPerWorker {
+		t.Fatalf("bad: %d leaves in %d chunks", len(got), chunks)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, prefix := range []string{"/registry/", "x"} {
+		err := r.Root().ParallelWalkPrefix(ctx, []byte(prefix), 4, func(chunk int, k []byte, v int) error {
+			t.Fatalf("bad: called after cancel")
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("bad: %v", err)
+		}
+	}
+}
+
+func TestNode_ParallelWalk_Chunks(t *testing.T) {
+	r := parallelBase(rand.New(rand.NewSource(1)), 5000)
+	chunks := r.Root().walkChunks(64, nil, false)
+	if len(chunks) < 64 {
+		t.Fatalf("bad: %d chunks", len(chunks))
+	}
+
+	// Every chunk is visited once, in key order.
+	var got []kv
+	for i := range chunks {
+		chunks[i].walk(false, func(k []byte, v int) bool {
+			got = append(got, kv{string(k), v})
+			return false
+		})
+	}
+	if want := collectWalk(r.Root().Walk); !reflect.DeepEqual(got, want) {
+		t.Fatalf("bad: chunks don't cover the tree")
+	}
+
+	// A tree that can't be split that far is split into leaves.
+	r = New[int]()
+	for _, k := range []string{"a", "ab", "b"} {
+		r, _, _ = r.Insert([]byte(k), 1)
+	}
+	if chunks := r.Root().walkChunks(64, nil, false); len(chunks) != 3 {
+		t.Fatalf("bad: %d chunks", len(chunks))
+	}
+}
+
+func TestNode_ParallelWalk_Error(t *testing.T) {
+	r := parallelBase(rand.New(rand.NewSource(2)), 5000)
+	errStop := errors.New("stop")
+	for _, workers := range []int{1, 4} {
+		var (
+			l     sync.Mutex
+			calls int
+		)
+		err := r.Root().ParallelWalk(context.Background(), workers, func(chunk int, k []byte, v int) error {
+			l.Lock()
+			defer l.Unlock()
+			calls++
+			if calls == 100 {
+				return fmt.Errorf("at %q: %w", k, errStop)
+			}
+			if calls > 100 {
+				return errors.New("not first")
+			}
+			return nil
+		})
+		if !errors.Is(err, errStop) {
+			t.Fatalf("bad: %v", err)
+		}
+		if workers == 1 && calls != 100 {
+			t.Fatalf("bad: %d calls", calls)
+		}
+		if calls >= r.Len() {
+			t.Fatalf("bad: walk didn't stop")
+		}
+	}
+}
+
+func TestNode_ParallelWalk_Cancel(t *testing.T) {
+	r := parallelBase(rand.New(rand.NewSource(3)), 5000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := r.Root().ParallelWalk(ctx, 4, func(chunk int, k []byte, v int) error {
+		t.Fatalf("bad: called after cancel")
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("bad: %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		l     sync.Mutex
+		calls int
+	)
+	err = r.Root().ParallelWalk(ctx, 4, func(chunk int, k []byte, v int) error {
+		l.Lock()
+		defer l.Unlock()
+		if calls++; calls == 100 {
+			cancel()
+			<-ctx.Done()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("bad: %v", err)
+	}
+	if calls >= r.Len() {
+		t.Fatalf("bad: walk didn't stop")
+	}
+}
+
+func benchmarkParallelWalk(b *testing.B, workers int) {
+	txn := New[int]().Txn()
+	for j := 0; j < 200000; j++ {
+		txn.Insert([]byte(fmt.Sprintf("/registry/services/service-%06d", j)), j)
+	}
+	r := txn.Commit()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := r.Root().ParallelWalk(context.Background(), workers, func(chunk int, k []byte, v int) error {
+			return nil
+		})
+		if err != nil {
+			b.Fatalf("err: %v", err)
+		}
+	}
+}
+
+func BenchmarkParallelWalk_1(b *testing.B) {
+	benchmarkParallelWalk(b, 1)
+}
+
+func BenchmarkParallelWalk_4(b *testing.B) {
+	benchmarkParallelWalk(b, 4)
+}
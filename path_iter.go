@@ -11,6 +11,10 @@ import "bytes"
 type PathIterator[T any] struct {
 	node *Node[T]
 	path []byte
+
+	// full is the whole path, which keys of compact trees are rebuilt
+	// from.
+	full []byte
 }
 
 // Next returns the next node in order
@@ -19,18 +23,20 @@ func (i *PathIterator[T]) Next() ([]byte, T, bool) {
 	// method on the node.
 	var zero T
 	var leaf *leafNode[T]
+	var key []byte
 
 	for leaf == nil && i.node != nil {
 		// visit the leaf values if any
 		if i.node.leaf != nil {
 			leaf = i.node.leaf
+			key = i.full[:len(i.full)-len(i.path)]
 		}
 
 		i.iterate()
 	}
 
 	if leaf != nil {
-		return leaf.key, leaf.val, true
+		return leaf.keyAt(key), leaf.val, true
 	}
 
 	return nil, zero, false
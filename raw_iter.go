@@ -39,6 +39,14 @@ func (i *rawIterator[T]) Path() string {
 	return i.path
 }
 
+// skipChildren makes the next call to Next move past all the children of
+// the current node. It must only be called right after Next.
+func (i *rawIterator[T]) skipChildren() {
+	if i.pos != nil && len(i.pos.edges) > 0 {
+		i.stack = i.stack[:len(i.stack)-1]
+	}
+}
+
 // Next advances the iterator to the next node.
 func (i *rawIterator[T]) Next() {
 	// Initialize our stack if needed.
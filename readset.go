@@ -0,0 +1,136 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// readRange is a contiguous range of keys read by an iterator. lo is
+// inclusive and nil means the start of the tree, hi is inclusive and
+// ignored if hiOpen is set. Nothing has been read until read is set.
+type readRange struct {
+	lo, hi []byte
+	hiOpen bool
+	read   bool
+}
+
+// contains returns true if k falls inside the range.
+func (r *readRange) contains(k []byte) bool {
+	if !r.read {
+		return false
+	}
+	if r.lo != nil && bytes.Compare(k, r.lo) < 0 {
+		return false
+	}
+	return r.hiOpen || bytes.Compare(k, r.hi) <= 0
+}
+
+// readSet records everything a transaction has read, so that it can be
+// checked against the keys changed by other commits.
+type readSet struct {
+	// keys holds keys read directly, whether or not they were found.
+	keys map[string]struct{}
+
+	// prefixes holds prefixes whose whole subtree was read.
+	prefixes [][]byte
+
+	// paths holds keys passed to LongestPrefix, whose result depends on
+	// every key that is a prefix of them.
+	paths [][]byte
+
+	// ranges holds the ranges covered by iterators.
+	ranges []*readRange
+}
+
+func (r *readSet) addKey(k []byte) {
+	if r.keys == nil {
+		r.keys = make(map[string]struct{})
+	}
+	r.keys[string(k)] = struct{}{}
+}
+
+// The slices passed in are copied, since callers may reuse them once the
+// read is done.
+
+func (r *readSet) addPrefix(prefix []byte) {
+	r.prefixes = append(r.prefixes, append([]byte(nil), prefix...))
+}
+
+func (r *readSet) addPath(k []byte) {
+	r.paths = append(r.paths, append([]byte(nil), k...))
+}
+
+func (r *readSet) addRange(lo, hi []byte, hiOpen bool) *readRange {
+	rng := &readRange{
+		lo:     append([]byte(nil), lo...),
+		hi:     append([]byte(nil), hi...),
+		hiOpen: hiOpen,
+	}
+	r.ranges = append(r.ranges, rng)
+	return rng
+}
+
+// conflicts returns true if a change to k would have affected anything in
+// the read set.
+func (r *readSet) conflicts(k []byte) bool {
+	if _, ok := r.keys[string(k)]; ok {
+		return true
+	}
+	for _, prefix := range r.prefixes {
+		if bytes.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	for _, path := range r.paths {
+		if bytes.HasPrefix(path, k) {
+			return true
+		}
+	}
+	for _, rng := range r.ranges {
+		if rng.contains(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrackReads can be used to toggle if reads are recorded. If this is
+// enabled then every key and prefix read through the transaction's Get,
+// GetWatch, LongestPrefix, Iterator and ReverseIterator methods is
+// recorded, along with every prefix passed to DeletePrefix, and
+// Store.Commit will refuse to commit the transaction if any
+// of those reads were invalidated by a commit made after the transaction
+// was started. Reads made through Root are not tracked.
+func (t *Txn[T]) TrackReads(track bool) {
+	if !track {
+		t.reads = nil
+		return
+	}
+	if t.reads == nil {
+		t.reads = &readSet{}
+	}
+}
+
+// validateReads checks the transaction's read set against the keys that
+// changed between its starting snapshot and root, returning an error
+// wrapping ErrCommitConflict for the first conflicting key.
+func (t *Txn[T]) validateReads(root *Node[T]) error {
+	if t.reads == nil {
+		return nil
+	}
+	var conflict []byte
+	var found bool
+	diffNodes(t.snap, root, func(k []byte, _, _ *leafNode[T]) bool {
+		if t.reads.conflicts(k) {
+			conflict, found = k, true
+		}
+		return found
+	})
+	if found {
+		return fmt.Errorf("%w: key %q", ErrCommitConflict, conflict)
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func newReadSetStore(t *testing.T) *Store[int] {
+	t.Helper()
+	r := New[int]()
+	for i, k := range []string{"a", "b/1", "b/2", "c", "d/1", "d/2", "e"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	return NewStore(r)
+}
+
+func TestStore_Commit_Disjoint(t *testing.T) {
+	s := newReadSetStore(t)
+
+	txn1 := s.Txn()
+	v, _ := txn1.Get([]byte("a"))
+	txn1.Insert([]byte("a"), v+10)
+
+	txn2 := s.Txn()
+	v, _ = txn2.Get([]byte("e"))
+	txn2.Insert([]byte("e"), v+10)
+	txn2.Delete([]byte("c"))
+
+	if _, err := s.Commit(txn1); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	nt, err := s.Commit(txn2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Both transactions' writes should be present.
+	if v, _ := nt.Get([]byte("a")); v != 10 {
+		t.Fatalf("bad: %d", v)
+	}
+	if v, _ := nt.Get([]byte("e")); v != 16 {
+		t.Fatalf("bad: %d", v)
+	}
+	if _, ok := nt.Get([]byte("c")); ok || nt.Len() != 6 {
+		t.Fatalf("bad: %d", nt.Len())
+	}
+}
+
+func TestStore_Commit_Conflicts(t *testing.T) {
+	cases := []struct {
+		name  string
+		read  func(txn *Txn[int])
+		write string
+		ok    bool
+	}{
+		{
+			"get",
+			func(txn *Txn[int]) { txn.Get([]byte("c")) },
+			"c", false,
+		},
+		{
+			"get missing key",
+			func(txn *Txn[int]) { txn.GetWatch([]byte("cc")) },
+			"cc", false,
+		},
+		{
+			"get other key",
+			func(txn *Txn[int]) { txn.Get([]byte("c")) },
+			"cc", true,
+		},
+		{
+			"longest prefix",
+			func(txn *Txn[int]) { txn.LongestPrefix([]byte("d/1/x")) },
+			"d/", false,
+		},
+		{
+			"longest prefix longer key",
+			func(txn *Txn[int]) { txn.LongestPrefix([]byte("d/1/x")) },
+			"d/1/y", true,
+		},
+		{
+			"seek prefix",
+			func(txn *Txn[int]) {
+				it := txn.Iterator()
+				it.SeekPrefix([]byte("b/"))
+			},
+			"b/3", false,
+		},
+		{
+			"seek prefix outside",
+			func(txn *Txn[int]) {
+				it := txn.ReverseIterator()
+				it.SeekPrefix([]byte("b/"))
+			},
+			"bb", true,
+		},
+		{
+			"lower bound read range",
+			func(txn *Txn[int]) {
+				it := txn.Iterator()
+				it.SeekLowerBound([]byte("b/2"))
+				it.Next()
+				it.Next()
+			},
+			"bz", false,
+		},
+		{
+			"lower bound past read range",
+			func(txn *Txn[int]) {
+				it := txn.Iterator()
+				it.SeekLowerBound([]byte("b/2"))
+				it.Next()
+				it.Next()
+			},
+			"cc", true,
+		},
+		{
+			"lower bound before range",
+			func(txn *Txn[int]) {
+				it := txn.Iterator()
+				it.SeekLowerBound([]byte("b/2"))
+				it.Next()
+			},
+			"b/1", true,
+		},
+		{
+			"full iteration",
+			func(txn *Txn[int]) {
+				it := txn.Iterator()
+				for _, _, ok := it.Next(); ok; _, _, ok = it.Next() {
+				}
+			},
+			"zzz", false,
+		},
+		{
+			"unread iterator",
+			func(txn *Txn[int]) { txn.Iterator() },
+			"zzz", true,
+		},
+		{
+			"reverse lower bound",
+			func(txn *Txn[int]) {
+				it := txn.ReverseIterator()
+				it.SeekReverseLowerBound([]byte("d/1"))
+				it.Previous()
+				it.Previous()
+			},
+			"cc", false,
+		},
+		{
+			"reverse lower bound above",
+			func(txn *Txn[int]) {
+				it := txn.ReverseIterator()
+				it.SeekReverseLowerBound([]byte("d/1"))
+				it.Previous()
+			},
+			"d/2", true,
+		},
+		{
+			"reverse exhausted",
+			func(txn *Txn[int]) {
+				it := txn.ReverseIterator()
+				it.SeekReverseLowerBound([]byte("b"))
+				it.Previous()
+				it.Previous()
+			},
+			"", false,
+		},
+		{
+			"delete prefix",
+			func(txn *Txn[int]) { txn.DeletePrefix([]byte("b/")) },
+			"b/3", false,
+		},
+		{
+			"delete prefix outside",
+			func(txn *Txn[int]) { txn.DeletePrefix([]byte("b/")) },
+			"bb", true,
+		},
+		{
+			"untracked root reads",
+			func(txn *Txn[int]) { txn.Root().Get([]byte("c")) },
+			"c", true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newReadSetStore(t)
+			txn := s.Txn()
+			tc.read(txn)
+			txn.Insert([]byte("z"), 0)
+
+			if _, err := s.Update(func(txn *Txn[int]) error {
+				txn.Insert([]byte(tc.write), 100)
+				return nil
+			}); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+
+			_, err := s.Commit(txn)
+			if tc.ok && err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if !tc.ok && !errors.Is(err, ErrCommitConflict) {
+				t.Fatalf("expected conflict, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestStore_Commit_BlindDeletePrefix(t *testing.T) {
+	s := newReadSetStore(t)
+	txn := s.Txn()
+	txn.TrackReads(false)
+	txn.DeletePrefix([]byte("b/"))
+
+	if _, err := s.Update(func(txn *Txn[int]) error {
+		txn.Insert([]byte("b/3"), 100)
+		return nil
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The prefix is deleted as a whole, including the key committed since
+	// the transaction started.
+	nt, err := s.Commit(txn)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	nt.Root().WalkPrefix([]byte("b/"), func(k []byte, _ int) bool {
+		t.Fatalf("bad: %q survived", k)
+		return false
+	})
+	if nt.Len() != 5 {
+		t.Fatalf("bad: %d", nt.Len())
+	}
+}
+
+func TestStore_Commit_ReusedBuffer(t *testing.T) {
+	cases := []struct {
+		name  string
+		read  func(txn *Txn[int], buf []byte)
+		reuse string
+		write string
+	}{
+		{"seek prefix", func(txn *Txn[int], buf []byte) {
+			iter := txn.Iterator()
+			iter.SeekPrefix(buf)
+			for _, _, ok := iter.Next(); ok; _, _, ok = iter.Next() {
+			}
+		}, "x/", "b/3"},
+		{"seek lower bound", func(txn *Txn[int], buf []byte) {
+			iter := txn.Iterator()
+			iter.SeekLowerBound(buf)
+			iter.Next()
+		}, "c/", "b/0"},
+		{"seek reverse lower bound", func(txn *Txn[int], buf []byte) {
+			iter := txn.ReverseIterator()
+			iter.SeekReverseLowerBound(buf)
+			iter.Previous()
+		}, "a/", "b"},
+		{"longest prefix", func(txn *Txn[int], buf []byte) {
+			txn.LongestPrefix(buf)
+		}, "x/", "b"},
+		{"delete prefix", func(txn *Txn[int], buf []byte) {
+			txn.DeletePrefix(buf)
+		}, "x/", "b/3"},
+	}
+	for _, c := range cases {
+		s := newReadSetStore(t)
+		txn := s.Txn()
+		buf := []byte("b/")
+		c.read(txn, buf)
+
+		// Reusing the buffer must not change what was recorded.
+		copy(buf, c.reuse)
+		if _, err := s.Update(func(txn *Txn[int]) error {
+			txn.Insert([]byte(c.write), 100)
+			return nil
+		}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if _, err := s.Commit(txn); !errors.Is(err, ErrCommitConflict) {
+			t.Fatalf("bad %s: %v", c.name, err)
+		}
+	}
+}
+
+func TestStore_Commit_Concurrent(t *testing.T) {
+	s := NewStore(New[int]())
+
+	// Each writer increments its own counter, so writers never conflict
+	// with each other, but retry anyway if they do.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			k := []byte{byte('a' + i)}
+			for j := 0; j < 100; j++ {
+				for {
+					txn := s.Txn()
+					v, _ := txn.Get(k)
+					txn.Insert(k, v+1)
+					if _, err := s.Commit(txn); err == nil {
+						break
+					} else if !errors.Is(err, ErrCommitConflict) {
+						t.Errorf("err: %v", err)
+						return
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	s.Snapshot().Root().Walk(func(k []byte, v int) bool {
+		if v != 100 {
+			t.Fatalf("bad: %s=%d", k, v)
+		}
+		return false
+	})
+}
@@ -0,0 +1,89 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import "fmt"
+
+// txnOp is a single operation recorded by a transaction, see TrackOps. kind
+// uses the same codes as the write-ahead log records. Keys are copies, since
+// callers may reuse them.
+type txnOp[T any] struct {
+	kind byte
+	key  []byte
+	val  T
+}
+
+// TrackOps can be used to toggle if the transaction records the Insert,
+// Delete and DeletePrefix operations applied to it, which is required for
+// Rebase. Operations applied before tracking was turned on are not
+// recorded, and turning it off discards the recorded operations.
+func (t *Txn[T]) TrackOps(track bool) {
+	t.trackOps = track
+	if !track {
+		t.ops = nil
+	}
+}
+
+// Rebase moves the transaction onto newBase, which is usually a tree that
+// was committed by another writer after this transaction was started, by
+// replaying the operations recorded since TrackOps was turned on. Any
+// earlier changes to the transaction are lost, so operations should be
+// tracked from the start.
+//
+// If a key touched by a replayed operation, or a key under a replayed
+// DeletePrefix, differs between the transaction's original base and
+// newBase, an error wrapping ErrCommitConflict is returned and the
+// transaction is left unchanged. The same applies to anything read through
+// the transaction if it is tracking reads. Mutation tracking restarts from
+// newBase so that only the nodes it shares with the result are notified.
+func (t *Txn[T]) Rebase(newBase *Tree[T]) error {
+	// Collect the keys that changed underneath the transaction.
+	changed := New[struct{}]().Txn()
+	diffNodes(t.snap, newBase.root, func(k []byte, _, _ *leafNode[T]) bool {
+		changed.Insert(k, struct{}{})
+		return false
+	})
+	if err := t.validateReads(newBase.root); err != nil {
+		return err
+	}
+	for _, op := range t.ops {
+		if op.kind == walDeletePrefix {
+			iter := changed.Root().Iterator()
+			iter.SeekPrefix(op.key)
+			if k, _, ok := iter.Next(); ok {
+				return fmt.Errorf("%w: key %q under deleted prefix %q", ErrCommitConflict, k, op.key)
+			}
+			continue
+		}
+		if _, ok := changed.Get(op.key); ok {
+			return fmt.Errorf("%w: key %q", ErrCommitConflict, op.key)
+		}
+	}
+
+	// Start over from the new base. The log, if any, has already recorded
+	// these operations, so it is detached while they are replayed.
+	ops, log := t.ops, t.log
+	t.root, t.snap, t.size = newBase.root, newBase.root, newBase.size
+	t.writable = nil
+	t.trackChannels = nil
+	t.trackOverflow = false
+	t.ops, t.log = nil, nil
+	t.replayOps(ops)
+	t.log = log
+	return nil
+}
+
+// replayOps applies recorded operations to the transaction.
+func (t *Txn[T]) replayOps(ops []txnOp[T]) {
+	for _, op := range ops {
+		switch op.kind {
+		case walInsert:
+			t.Insert(op.key, op.val)
+		case walDelete:
+			t.Delete(op.key)
+		case walDeletePrefix:
+			t.DeletePrefix(op.key)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTxn_Rebase(t *testing.T) {
+	r := New[int]()
+	for i, k := range []string{"a", "b/1", "b/2", "c"} {
+		r, _, _ = r.Insert([]byte(k), i)
+	}
+	s := NewStore(r)
+
+	base := s.Snapshot()
+	txn := s.Txn()
+	txn.Insert([]byte("a"), 10)
+	txn.Delete([]byte("c"))
+	txn.DeletePrefix([]byte("b/"))
+	txn.Insert([]byte("b/3"), 13)
+
+	// Another writer sneaks in a change to an unrelated key.
+	if _, err := s.Update(func(txn *Txn[int]) error {
+		txn.Insert([]byte("d"), 4)
+		return nil
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if _, err := s.CompareAndCommit(base, txn); err != ErrCommitConflict {
+		t.Fatalf("expected conflict, got: %v", err)
+	}
+	newBase := s.Snapshot()
+	if err := txn.Rebase(newBase); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	nt, err := s.CompareAndCommit(newBase, txn)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	expect := map[string]int{"a": 10, "b/3": 13, "d": 4}
+	got := make(map[string]int)
+	nt.Root().Walk(func(k []byte, v int) bool {
+		got[string(k)] = v
+		return false
+	})
+	if !reflect.DeepEqual(got, expect) || nt.Len() != len(expect) {
+		t.Fatalf("bad: %v", got)
+	}
+}
+
+func TestTxn_Rebase_Conflicts(t *testing.T) {
+	cases := []struct {
+		name  string
+		op    func(txn *Txn[int])
+		other string
+		ok    bool
+	}{
+		{"insert", func(txn *Txn[int]) { txn.Insert([]byte("foo"), 1) }, "foo", false},
+		{"insert other", func(txn *Txn[int]) { txn.Insert([]byte("foo"), 1) }, "foobar", true},
+		{"delete missing", func(txn *Txn[int]) { txn.Delete([]byte("foo")) }, "foo", false},
+		{"delete prefix", func(txn *Txn[int]) { txn.DeletePrefix([]byte("fo")) }, "foobar", false},
+		{"delete prefix other", func(txn *Txn[int]) { txn.DeletePrefix([]byte("fo")) }, "f", true},
+		{"read", func(txn *Txn[int]) { txn.Get([]byte("foo")) }, "foo", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			base := New[int]()
+			txn := base.Txn()
+			txn.TrackOps(true)
+			txn.TrackReads(true)
+			tc.op(txn)
+			before := txn.Root()
+
+			newBase, _, _ := base.Insert([]byte(tc.other), 2)
+			err := txn.Rebase(newBase)
+			if tc.ok && err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if !tc.ok {
+				if !errors.Is(err, ErrCommitConflict) {
+					t.Fatalf("expected conflict, got: %v", err)
+				}
+				if txn.Root() != before {
+					t.Fatalf("transaction should be unchanged")
+				}
+			}
+		})
+	}
+}
+
+func TestTxn_Rebase_LogAndNotify(t *testing.T) {
+	var log bytes.Buffer
+	base, _, _ := New[string]().Insert([]byte("foo"), "1")
+	txn := base.Txn()
+	txn.TrackOps(true)
+	txn.TrackMutate(true)
+	txn.SetLog(&log, stringCodec{})
+	txn.Insert([]byte("foo"), "2")
+
+	newBase, _, _ := base.Insert([]byte("bar"), "3")
+	watch, _, _ := newBase.Root().GetWatch([]byte("foo"))
+	if err := txn.Rebase(newBase); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	nt := txn.Commit()
+	if v, _ := nt.Get([]byte("foo")); v != "2" || nt.Len() != 2 {
+		t.Fatalf("bad: %v %d", v, nt.Len())
+	}
+
+	// The replayed operations aren't logged again.
+	var want bytes.Buffer
+	single := base.Txn()
+	single.SetLog(&want, stringCodec{})
+	single.Insert([]byte("foo"), "2")
+	single.Commit()
+	if !bytes.Equal(log.Bytes(), want.Bytes()) {
+		t.Fatalf("replayed operations should not be logged again")
+	}
+	select {
+	case <-watch:
+	default:
+		t.Fatalf("watch on the new base should fire")
+	}
+}
+
+func TestStore_Commit_ReusedDeleteKey(t *testing.T) {
+	cases := []struct {
+		name   string
+		delete func(txn *Txn[int], buf []byte)
+	}{
+		{"delete", func(txn *Txn[int], buf []byte) {
+			txn.Delete(buf)
+		}},
+		{"delete prefix", func(txn *Txn[int], buf []byte) {
+			txn.DeletePrefix(buf)
+		}},
+		{"apply parallel", func(txn *Txn[int], buf []byte) {
+			txn.ApplyParallel([]TxnOp[int]{{Key: buf, Delete: true}, {Key: []byte("z"), Val: 1}}, 2)
+		}},
+	}
+	for _, c := range cases {
+		s := NewStore(New[int]())
+		if _, err := s.Update(func(txn *Txn[int]) error {
+			txn.Insert([]byte("a"), 1)
+			txn.Insert([]byte("b"), 2)
+			return nil
+		}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		txn := s.Txn()
+		buf := []byte("a")
+		c.delete(txn, buf)
+		buf[0] = 'b'
+
+		// A commit in between makes Store.Commit replay the operations.
+		if _, err := s.Update(func(txn *Txn[int]) error {
+			txn.Insert([]byte("c"), 3)
+			return nil
+		}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		nt, err := s.Commit(txn)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if _, ok := nt.Get([]byte("a")); ok {
+			t.Fatalf("bad %s: a survived", c.name)
+		}
+		if _, ok := nt.Get([]byte("b")); !ok {
+			t.Fatalf("bad %s: b was deleted", c.name)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// defaultReconcileBulkThreshold is the number of entries under a
+	// differing prefix at or below which the entries are exchanged directly
+	// instead of descending another level.
+	defaultReconcileBulkThreshold = 32
+)
+
+// ErrReconcileProtocol is returned when the peer sends a message that does
+// not match the current round of the reconciliation.
+var ErrReconcileProtocol = errors.New("reconcile: protocol mismatch")
+
+// ReconcileChild is the digest of all the entries whose keys extend a
+// prefix by the given label byte.
+type ReconcileChild struct {
+	Label byte
+	Hash  [sha256.Size]byte
+	Count int
+}
+
+// ReconcileDigest describes the entries stored under one prefix of the
+// frontier. Leaf is the hash of the entry whose key is exactly the prefix,
+// if HasLeaf is set, and Children holds one digest per next key byte in
+// ascending label order.
+type ReconcileDigest struct {
+	HasLeaf  bool
+	Leaf     [sha256.Size]byte
+	Children []ReconcileChild
+}
+
+// ReconcileEntry is a key and its encoded value sent to the peer.
+type ReconcileEntry struct {
+	Key   []byte
+	Value []byte
+}
+
+// ReconcileMessage is exchanged once per round. Digests holds one digest for
+// each prefix of the current frontier, in frontier order, and Entries holds
+// the entries under the prefixes found to differ in the previous round.
+type ReconcileMessage struct {
+	Digests []ReconcileDigest
+	Entries []ReconcileEntry
+}
+
+// ReconcileTransport carries messages between the two sides of a
+// reconciliation. Both sides send exactly one message per round and then
+// receive the peer's message for the same round. Send is called
+// concurrently with Recv, so unbuffered transports such as net.Pipe are
+// fine.
+//
+// If Recv fails, Reconcile returns without waiting for Send, since a Send
+// to a peer that has gone away may never finish. Transports that implement
+// io.Closer are closed first, which should make a blocked Send return.
+type ReconcileTransport interface {
+	Send(msg *ReconcileMessage) error
+	Recv() (*ReconcileMessage, error)
+}
+
+// ReconcileConfig configures Reconcile.
+type ReconcileConfig[T any] struct {
+	// Codec is used to hash values and to move them across the transport.
+	// It is required.
+	Codec Codec[T]
+
+	// Resolve picks the value to keep when both sides hold a key with
+	// different values. It must return the same result regardless of
+	// argument order, otherwise the two sides will not converge. If it is
+	// nil the value whose encoding sorts last wins.
+	Resolve func(k []byte, local, remote T) T
+
+	// BulkThreshold is the number of entries under a differing prefix at or
+	// below which entries are sent rather than descending further. Both
+	// sides must use the same value. Defaults to
+	// defaultReconcileBulkThreshold.
+	BulkThreshold int
+}
+
+// Reconcile runs an anti-entropy session against a peer that is running
+// Reconcile on its own copy of the tree. The two sides exchange subtree
+// hashes level by level, starting at the root, and only the entries under
+// prefixes whose hashes differ are sent. The returned tree holds the union
+// of both sides' entries, with conflicting values settled by the configured
+// Resolve function, so both sides end up with identical trees.
+//
+// Deletes are not propagated since a missing key can't be told apart from
+// one the peer has never seen; callers that need that should store
+// tombstone values instead.
+func Reconcile[T any](t *Tree[T], tr ReconcileTransport, conf ReconcileConfig[T]) (*Tree[T], error) {
+	if conf.Codec == nil {
+		return nil, errors.New("reconcile: missing codec")
+	}
+	threshold := conf.BulkThreshold
+	if threshold <= 0 {
+		threshold = defaultReconcileBulkThreshold
+	}
+	r := &reconciler[T]{
+		root:    t.root,
+		compact: t.compact,
+		codec:   conf.Codec,
+		hashes:  make(map[*Node[T]]reconcileHash),
+	}
+
+	txn := t.Txn()
+	frontier := [][]byte{nil}
+	var pending []ReconcileEntry
+	var sending bool
+	for len(frontier) > 0 || sending {
+		msg := &ReconcileMessage{
+			Digests: make([]ReconcileDigest, 0, len(frontier)),
+			Entries: pending,
+		}
+		for _, prefix := range frontier {
+			d, err := r.digest(prefix)
+			if err != nil {
+				return nil, err
+			}
+			msg.Digests = append(msg.Digests, d)
+		}
+
+		remote, err := exchange(tr, msg)
+		if err != nil {
+			return nil, err
+		}
+		if len(remote.Digests) != len(frontier) {
+			return nil, fmt.Errorf("%w: got %d digests, expected %d",
+				ErrReconcileProtocol, len(remote.Digests), len(frontier))
+		}
+		if err := r.apply(txn, remote.Entries, conf.Resolve); err != nil {
+			return nil, err
+		}
+
+		// Both sides hold the same pair of digests for every prefix, so
+		// they agree on the next frontier and the prefixes to exchange
+		// without any further coordination.
+		var next, bulk, exact [][]byte
+		for idx, prefix := range frontier {
+			local, remote := msg.Digests[idx], remote.Digests[idx]
+			if local.HasLeaf != remote.HasLeaf || local.Leaf != remote.Leaf {
+				exact = append(exact, prefix)
+			}
+			diffChildren(local.Children, remote.Children, func(label byte, count int, bothSides bool) {
+				child := concat(prefix, []byte{label})
+				if bothSides && count > threshold {
+					next = append(next, child)
+				} else {
+					bulk = append(bulk, child)
+				}
+			})
+		}
+
+		// Whether another round is needed can't depend on the local
+		// entries, since one side may have nothing to send.
+		sending = len(exact) > 0 || len(bulk) > 0
+		pending, err = r.entries(exact, bulk)
+		if err != nil {
+			return nil, err
+		}
+		frontier = next
+	}
+	return txn.Commit(), nil
+}
+
+// exchange sends msg and receives the peer's message for the same round.
+func exchange(tr ReconcileTransport, msg *ReconcileMessage) (*ReconcileMessage, error) {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- tr.Send(msg)
+	}()
+	remote, err := tr.Recv()
+	if err != nil {
+		if c, ok := tr.(io.Closer); ok {
+			c.Close()
+		}
+		return nil, err
+	}
+	if err := <-errCh; err != nil {
+		return nil, err
+	}
+	return remote, nil
+}
+
+// diffChildren calls fn for every label whose digest differs between the
+// two sorted child lists, with the larger of the two counts and whether the
+// label is present on both sides.
+func diffChildren(local, remote []ReconcileChild, fn func(label byte, count int, bothSides bool)) {
+	i, j := 0, 0
+	for i < len(local) || j < len(remote) {
+		switch {
+		case j == len(remote) || (i < len(local) && local[i].Label < remote[j].Label):
+			fn(local[i].Label, local[i].Count, false)
+			i++
+		case i == len(local) || remote[j].Label < local[i].Label:
+			fn(remote[j].Label, remote[j].Count, false)
+			j++
+		default:
+			if local[i].Hash != remote[j].Hash {
+				count := local[i].Count
+				if remote[j].Count > count {
+					count = remote[j].Count
+				}
+				fn(local[i].Label, count, true)
+			}
+			i++
+			j++
+		}
+	}
+}
+
+// reconcileHash is the cached digest of a node's subtree.
+type reconcileHash struct {
+	hash  [sha256.Size]byte
+	count int
+}
+
+// reconciler holds the local state of a reconciliation session.
+type reconciler[T any] struct {
+	root    *Node[T]
+	compact bool
+	codec   Codec[T]
+
+	// hashes caches subtree digests. The tree being reconciled is never
+	// modified, so these stay valid for the whole session.
+	hashes map[*Node[T]]reconcileHash
+}
+
+// leafHash returns the hash of a single key and value. path is the path to
+// the leaf, which is only needed for compact trees.
+func (r *reconciler[T]) leafHash(l *leafNode[T], path []byte) ([sha256.Size]byte, error) {
+	v, err := r.codec.Encode(l.val)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	key := l.key
+	if key == nil {
+		key = path
+	}
+	var lenBuf [binary.MaxVarintLen64]byte
+	h := sha256.New()
+	h.Write(lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(key)))])
+	h.Write(key)
+	h.Write(v)
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// nodeHash returns the digest of all the entries under n. The hash of a set
+// of entries is the XOR of the entry hashes, which makes it independent of
+// how the entries happen to be split into nodes on either side. For compact
+// trees, parent is the path to the parent of n, and is reused as the hash
+// is computed.
+func (r *reconciler[T]) nodeHash(n *Node[T], parent []byte) (reconcileHash, error) {
+	if h, ok := r.hashes[n]; ok {
+		return h, nil
+	}
+
+	path := parent
+	if r.compact {
+		path = append(parent, n.prefix...)
+	}
+	var out reconcileHash
+	if n.leaf != nil {
+		h, err := r.leafHash(n.leaf, path)
+		if err != nil {
+			return out, err
+		}
+		out.hash = h
+		out.count = 1
+	}
+	for _, e := range n.edges {
+		h, err := r.nodeHash(e.node, path)
+		if err != nil {
+			return out, err
+		}
+		xorHash(&out.hash, &h.hash)
+		out.count += h.count
+	}
+	r.hashes[n] = out
+	return out, nil
+}
+
+// digest builds the digest of the entries under the given prefix.
+func (r *reconciler[T]) digest(prefix []byte) (ReconcileDigest, error) {
+	var d ReconcileDigest
+	n, rest := seekNode(r.root, prefix)
+	if n == nil {
+		return d, nil
+	}
+
+	// Compact trees need the path to the node, which the hashes build on,
+	// so it's copied to leave the prefix alone.
+	var path []byte
+	if r.compact {
+		path = append(append([]byte(nil), prefix...), rest...)
+	}
+
+	// The node's path runs past the prefix, so everything under it shares
+	// the next byte.
+	if len(rest) > 0 {
+		var parent []byte
+		if r.compact {
+			parent = path[:len(path)-len(n.prefix)]
+		}
+		h, err := r.nodeHash(n, parent)
+		if err != nil {
+			return d, err
+		}
+		d.Children = []ReconcileChild{{Label: rest[0], Hash: h.hash, Count: h.count}}
+		return d, nil
+	}
+
+	if n.leaf != nil {
+		h, err := r.leafHash(n.leaf, path)
+		if err != nil {
+			return d, err
+		}
+		d.HasLeaf = true
+		d.Leaf = h
+	}
+	for _, e := range n.edges {
+		h, err := r.nodeHash(e.node, path)
+		if err != nil {
+			return d, err
+		}
+		d.Children = append(d.Children, ReconcileChild{Label: e.label, Hash: h.hash, Count: h.count})
+	}
+	return d, nil
+}
+
+// entries collects the local entries whose key is one of exact, or which
+// fall under one of the bulk prefixes.
+func (r *reconciler[T]) entries(exact, bulk [][]byte) ([]ReconcileEntry, error) {
+	var out []ReconcileEntry
+	var err error
+	add := func(k []byte, v T) bool {
+		var b []byte
+		if b, err = r.codec.Encode(v); err != nil {
+			return true
+		}
+		out = append(out, ReconcileEntry{Key: k, Value: b})
+		return false
+	}
+	for _, k := range exact {
+		if v, ok := r.root.Get(k); ok {
+			add(k, v)
+		}
+	}
+	for _, prefix := range bulk {
+		r.root.WalkPrefix(prefix, add)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// apply merges the peer's entries into the transaction.
+func (r *reconciler[T]) apply(txn *Txn[T], entries []ReconcileEntry, resolve func(k []byte, local, remote T) T) error {
+	for _, e := range entries {
+		remote, err := r.codec.Decode(e.Value)
+		if err != nil {
+			return err
+		}
+		local, ok := txn.Get(e.Key)
+		switch {
+		case !ok:
+			txn.Insert(e.Key, remote)
+		case resolve != nil:
+			txn.Insert(e.Key, resolve(e.Key, local, remote))
+		default:
+			b, err := r.codec.Encode(local)
+			if err != nil {
+				return err
+			}
+			if bytes.Compare(e.Value, b) > 0 {
+				txn.Insert(e.Key, remote)
+			}
+		}
+	}
+	return nil
+}
+
+// seekNode finds the highest node whose path starts with prefix. It returns
+// the node along with the part of the node's path that runs past the
+// prefix, or nil if no key starts with prefix.
+func seekNode[T any](n *Node[T], prefix []byte) (*Node[T], []byte) {
+	search := prefix
+	for len(search) > 0 {
+		_, n = n.getEdge(search[0])
+		if n == nil {
+			return nil, nil
+		}
+		switch {
+		case bytes.HasPrefix(search, n.prefix):
+			search = search[len(n.prefix):]
+		case bytes.HasPrefix(n.prefix, search):
+			return n, n.prefix[len(search):]
+		default:
+			return nil, nil
+		}
+	}
+	return n, nil
+}
+
+// xorHash folds b into a.
+func xorHash(a, b *[sha256.Size]byte) {
+	for i := range a {
+		a[i] ^= b[i]
+	}
+}
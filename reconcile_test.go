@@ -0,0 +1,211 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// stringCodec is a Codec for string values used by tests.
+type stringCodec struct{}
+
+func (stringCodec) Encode(v string) ([]byte, error) { return []byte(v), nil }
+func (stringCodec) Decode(b []byte) (string, error) { return string(b), nil }
+
+// chanTransport is an in-memory ReconcileTransport that counts the entries
+// it sends.
+type chanTransport struct {
+	in, out chan *ReconcileMessage
+	rounds  int
+	sent    int
+}
+
+func (c *chanTransport) Send(msg *ReconcileMessage) error {
+	c.rounds++
+	c.sent += len(msg.Entries)
+	c.out <- msg
+	return nil
+}
+
+func (c *chanTransport) Recv() (*ReconcileMessage, error) {
+	return <-c.in, nil
+}
+
+func newChanTransports() (*chanTransport, *chanTransport) {
+	a, b := make(chan *ReconcileMessage), make(chan *ReconcileMessage)
+	return &chanTransport{in: a, out: b}, &chanTransport{in: b, out: a}
+}
+
+func reconcilePair(t *testing.T, left, right *Tree[string], conf ReconcileConfig[string]) (*Tree[string], *Tree[string], *chanTransport) {
+	t.Helper()
+	lt, rt := newChanTransports()
+
+	type result struct {
+		tree *Tree[string]
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		out, err := Reconcile(right, rt, conf)
+		ch <- result{out, err}
+	}()
+	l, err := Reconcile(left, lt, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	res := <-ch
+	if res.err != nil {
+		t.Fatalf("err: %v", res.err)
+	}
+	return l, res.tree, lt
+}
+
+func treeContents(r *Tree[string]) map[string]string {
+	out := make(map[string]string)
+	r.Root().Walk(func(k []byte, v string) bool {
+		out[string(k)] = v
+		return false
+	})
+	return out
+}
+
+func TestReconcile(t *testing.T) {
+	base := New[string]()
+	txn := base.Txn()
+	for i := 0; i < 10000; i++ {
+		k := fmt.Sprintf("key/%05d", i)
+		txn.Insert([]byte(k), k)
+	}
+	base = txn.Commit()
+
+	left, _, _ := base.Insert([]byte("key/00042"), "left")
+	left, _, _ = left.Insert([]byte("key/only-left"), "l")
+	left, _, _ = left.Insert([]byte("key"), "exact")
+	right, _, _ := base.Insert([]byte("key/00042"), "right")
+	right, _, _ = right.Insert([]byte("key/09999/sub"), "r")
+
+	l, r, tr := reconcilePair(t, left, right, ReconcileConfig[string]{Codec: stringCodec{}})
+
+	lc, rc := treeContents(l), treeContents(r)
+	if !reflect.DeepEqual(lc, rc) {
+		t.Fatalf("trees did not converge")
+	}
+	if l.Len() != base.Len()+3 || r.Len() != l.Len() {
+		t.Fatalf("bad len: %d %d", l.Len(), r.Len())
+	}
+	if lc["key/00042"] != "right" || lc["key/only-left"] != "l" ||
+		lc["key/09999/sub"] != "r" || lc["key"] != "exact" {
+		t.Fatalf("bad: %v", lc)
+	}
+
+	// Only the entries under small differing subtrees should have been
+	// sent, not the whole tree.
+	if tr.sent > 4*defaultReconcileBulkThreshold {
+		t.Fatalf("sent too many entries: %d", tr.sent)
+	}
+}
+
+func TestReconcile_Identical(t *testing.T) {
+	r := New[string]()
+	for i := 0; i < 100; i++ {
+		r, _, _ = r.Insert([]byte(strconv.Itoa(i)), "v")
+	}
+
+	l, rr, tr := reconcilePair(t, r, r, ReconcileConfig[string]{Codec: stringCodec{}})
+	if tr.rounds != 1 || tr.sent != 0 {
+		t.Fatalf("bad: %d rounds, %d sent", tr.rounds, tr.sent)
+	}
+	if l.Root() != r.Root() || rr.Root() != r.Root() {
+		t.Fatalf("tree should not have been modified")
+	}
+}
+
+func TestReconcile_EmptySide(t *testing.T) {
+	r := New[string]()
+	for i := 0; i < 500; i++ {
+		r, _, _ = r.Insert([]byte(strconv.Itoa(i)), strconv.Itoa(i))
+	}
+
+	l, rr, _ := reconcilePair(t, New[string](), r, ReconcileConfig[string]{Codec: stringCodec{}})
+	if !reflect.DeepEqual(treeContents(l), treeContents(r)) {
+		t.Fatalf("left did not receive all entries")
+	}
+	if rr.Root() != r.Root() {
+		t.Fatalf("right should not have been modified")
+	}
+}
+
+func TestReconcile_Resolve(t *testing.T) {
+	left, _, _ := New[string]().Insert([]byte("foo"), "aaa")
+	right, _, _ := New[string]().Insert([]byte("foo"), "bb")
+
+	conf := ReconcileConfig[string]{
+		Codec: stringCodec{},
+		Resolve: func(k []byte, local, remote string) string {
+			if len(local) > len(remote) {
+				return local
+			}
+			return remote
+		},
+	}
+	l, r, _ := reconcilePair(t, left, right, conf)
+	if v, _ := l.Get([]byte("foo")); v != "aaa" {
+		t.Fatalf("bad: %v", v)
+	}
+	if v, _ := r.Get([]byte("foo")); v != "aaa" {
+		t.Fatalf("bad: %v", v)
+	}
+}
+
+// deadTransport is a ReconcileTransport for a peer that has gone away: Recv
+// fails, and Send blocks until the transport is closed.
+type deadTransport struct {
+	closed chan struct{}
+}
+
+var errPeerGone = errors.New("peer gone")
+
+func (d *deadTransport) Send(msg *ReconcileMessage) error {
+	<-d.closed
+	return errPeerGone
+}
+
+func (d *deadTransport) Recv() (*ReconcileMessage, error) {
+	return nil, errPeerGone
+}
+
+func (d *deadTransport) Close() error {
+	close(d.closed)
+	return nil
+}
+
+func TestReconcile_RecvError(t *testing.T) {
+	r, _, _ := New[string]().Insert([]byte("foo"), "bar")
+	tr := &deadTransport{closed: make(chan struct{})}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := Reconcile(r, tr, ReconcileConfig[string]{Codec: stringCodec{}})
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, errPeerGone) {
+			t.Fatalf("err: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Reconcile hung on a blocked Send")
+	}
+
+	select {
+	case <-tr.closed:
+	default:
+		t.Fatalf("bad: transport wasn't closed")
+	}
+}
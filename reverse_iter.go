@@ -21,24 +21,31 @@ type ReverseIterator[T any] struct {
 	// We use this to track whether we have already ensured all the children are
 	// in the stack.
 	expandedParents map[*Node[T]]struct{}
+
+	// rng is the range currently being read, when the iterator belongs to
+	// a transaction that is tracking reads. Prefix reads are recorded by
+	// the wrapped iterator.
+	rng *readRange
 }
 
 // NewReverseIterator returns a new ReverseIterator at a node
 func NewReverseIterator[T any](n *Node[T]) *ReverseIterator[T] {
 	return &ReverseIterator[T]{
-		i: &Iterator[T]{node: n},
+		i: &Iterator[T]{node: n, compact: n.isCompact()},
 	}
 }
 
 // SeekPrefixWatch is used to seek the iterator to a given prefix
 // and returns the watch channel of the finest granularity
 func (ri *ReverseIterator[T]) SeekPrefixWatch(prefix []byte) (watch <-chan struct{}) {
+	ri.rng = nil
 	return ri.i.SeekPrefixWatch(prefix)
 }
 
 // SeekPrefix is used to seek the iterator to a given prefix
 func (ri *ReverseIterator[T]) SeekPrefix(prefix []byte) {
-	ri.i.SeekPrefixWatch(prefix)
+	ri.rng = nil
+	ri.i.seekPrefix(prefix)
 }
 
 // SeekReverseLowerBound is used to seek the iterator to the largest key that is
@@ -52,6 +59,10 @@ func (ri *ReverseIterator[T]) SeekReverseLowerBound(key []byte) {
 	// children that we don't traverse on the way to the reverse lower bound as it
 	// walks the stack.
 	ri.i.stack = []edges[T]{}
+	ri.i.depths = nil
+	if ri.i.reads != nil {
+		ri.rng = ri.i.reads.addRange(nil, key, false)
+	}
 	// ri.i.node starts off in the common case as pointing to the root node of the
 	// tree. By the time we return we have either found a lower bound and setup
 	// the stack to traverse all larger keys, or we have not and the stack and
@@ -62,12 +73,16 @@ func (ri *ReverseIterator[T]) SeekReverseLowerBound(key []byte) {
 	ri.i.node = nil
 	search := key
 
+	// The search follows the key, so for compact trees the path to every
+	// node on the way is a prefix of the key.
+	ri.i.setPath(key)
+
 	if ri.expandedParents == nil {
 		ri.expandedParents = make(map[*Node[T]]struct{})
 	}
 
-	found := func(n *Node[T]) {
-		ri.i.stack = append(ri.i.stack, edges[T]{edge[T]{node: n}})
+	found := func(n *Node[T], depth int) {
+		ri.i.push(edges[T]{edge[T]{node: n}}, depth)
 		// We need to mark this node as expanded in advance too otherwise the
 		// iterator will attempt to walk all of its children even though they are
 		// greater than the lower bound we have found. We've expanded it in the
@@ -77,6 +92,9 @@ func (ri *ReverseIterator[T]) SeekReverseLowerBound(key []byte) {
 	}
 
 	for {
+		// The length of the path to the parent of n.
+		depth := len(key) - len(search)
+
 		// Compare current prefix with the search key's same-length prefix.
 		var prefixCmp int
 		if len(n.prefix) < len(search) {
@@ -95,7 +113,7 @@ func (ri *ReverseIterator[T]) SeekReverseLowerBound(key []byte) {
 			// if it finds a node in the stack that has _not_ been marked as expanded
 			// so in this one case we don't call `found` and instead let the iterator
 			// do the expansion and recursion through all the children.
-			ri.i.stack = append(ri.i.stack, edges[T]{edge[T]{node: n}})
+			ri.i.push(edges[T]{edge[T]{node: n}}, depth)
 			return
 		}
 
@@ -113,9 +131,10 @@ func (ri *ReverseIterator[T]) SeekReverseLowerBound(key []byte) {
 		// greater.
 		if n.isLeaf() {
 
-			// Firstly, if it's an exact match, we're done!
-			if bytes.Equal(n.leaf.key, key) {
-				found(n)
+			// Firstly, if it's an exact match, meaning the prefix is the rest of
+			// the search key, we're done!
+			if len(n.prefix) == len(search) {
+				found(n, depth)
 				return
 			}
 
@@ -125,7 +144,7 @@ func (ri *ReverseIterator[T]) SeekReverseLowerBound(key []byte) {
 			// If it has no children then we are also done.
 			if len(n.edges) == 0 {
 				// This leaf is the lower bound.
-				found(n)
+				found(n, depth)
 				return
 			}
 
@@ -133,7 +152,7 @@ func (ri *ReverseIterator[T]) SeekReverseLowerBound(key []byte) {
 			// but we need to add it to the iterator's stack since it has a leaf value
 			// that needs to be iterated over. It needs to be added to the stack
 			// before its children below as it comes first.
-			ri.i.stack = append(ri.i.stack, edges[T]{edge[T]{node: n}})
+			ri.i.push(edges[T]{edge[T]{node: n}}, depth)
 			// We also need to mark it as expanded since we'll be adding any of its
 			// relevant children below and so don't want the iterator to re-add them
 			// on its way back up the stack.
@@ -169,7 +188,7 @@ func (ri *ReverseIterator[T]) SeekReverseLowerBound(key []byte) {
 
 		// Create stack edges for the all strictly lower edges in this node.
 		if len(n.edges[:idx]) > 0 {
-			ri.i.stack = append(ri.i.stack, n.edges[:idx])
+			ri.i.push(n.edges[:idx], len(key)-len(search))
 		}
 
 		// Exit if there's no lower bound edge. The stack will have the previous
@@ -187,11 +206,7 @@ func (ri *ReverseIterator[T]) SeekReverseLowerBound(key []byte) {
 func (ri *ReverseIterator[T]) Previous() ([]byte, T, bool) {
 	// Initialize our stack if needed
 	if ri.i.stack == nil && ri.i.node != nil {
-		ri.i.stack = []edges[T]{
-			{
-				edge[T]{node: ri.i.node},
-			},
-		}
+		ri.i.push(edges[T]{edge[T]{node: ri.i.node}}, len(ri.i.path))
 	}
 
 	if ri.expandedParents == nil {
@@ -204,6 +219,7 @@ func (ri *ReverseIterator[T]) Previous() ([]byte, T, bool) {
 		last := ri.i.stack[n-1]
 		m := len(last)
 		elem := last[m-1].node
+		through := ri.i.visit(elem, ri.i.depth())
 
 		_, alreadyExpanded := ri.expandedParents[elem]
 
@@ -215,7 +231,7 @@ func (ri *ReverseIterator[T]) Previous() ([]byte, T, bool) {
 			ri.expandedParents[elem] = struct{}{}
 			// push child edges onto stack and skip the rest of the loop to recurse
 			// into the largest one.
-			ri.i.stack = append(ri.i.stack, elem.edges)
+			ri.i.push(elem.edges, through)
 			continue
 		}
 
@@ -223,7 +239,7 @@ func (ri *ReverseIterator[T]) Previous() ([]byte, T, bool) {
 		if m > 1 {
 			ri.i.stack[n-1] = last[:m-1]
 		} else {
-			ri.i.stack = ri.i.stack[:n-1]
+			ri.i.pop()
 		}
 		// We don't need this state any more as it's no longer in the stack so we
 		// won't visit it again
@@ -233,11 +249,18 @@ func (ri *ReverseIterator[T]) Previous() ([]byte, T, bool) {
 
 		// If this is a leaf, return it
 		if elem.leaf != nil {
-			return elem.leaf.key, elem.leaf.val, true
+			key := elem.leaf.keyAt(ri.i.path)
+			if ri.rng != nil {
+				ri.rng.lo, ri.rng.read = key, true
+			}
+			return key, elem.leaf.val, true
 		}
 
 		// it's not a leaf so keep walking the stack to find the previous leaf
 	}
+	if ri.rng != nil {
+		ri.rng.lo, ri.rng.read = nil, true
+	}
 	var zero T
 	return nil, zero, false
 }
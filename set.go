@@ -0,0 +1,255 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+// Set is an immutable sorted set of keys, built on a Tree with empty
+// values. Sets derived from one another share most of their nodes, which
+// the set operations take advantage of by skipping shared subtrees, so
+// combining a set with a modified copy of itself costs time proportional to
+// the modifications rather than the size of the sets.
+type Set struct {
+	tree *Tree[struct{}]
+}
+
+// NewSet returns an empty Set.
+func NewSet() *Set {
+	return &Set{tree: New[struct{}]()}
+}
+
+// Len returns the number of keys in the set.
+func (s *Set) Len() int {
+	return s.tree.Len()
+}
+
+// Root returns the root node of the set, which can be used for richer query
+// operations.
+func (s *Set) Root() *Node[struct{}] {
+	return s.tree.Root()
+}
+
+// Contains returns true if the key is in the set.
+func (s *Set) Contains(k []byte) bool {
+	_, ok := s.tree.Get(k)
+	return ok
+}
+
+// GetWatch returns a watch channel that is closed when the key is added to
+// or removed from the set, along with if the key is in the set.
+func (s *Set) GetWatch(k []byte) (<-chan struct{}, bool) {
+	watch, _, ok := s.tree.Root().GetWatch(k)
+	return watch, ok
+}
+
+// Add returns a new set with the key added, and a bool indicating if the key
+// was already in the set.
+func (s *Set) Add(k []byte) (*Set, bool) {
+	txn := s.Txn()
+	ok := txn.Add(k)
+	return txn.Commit(), ok
+}
+
+// Remove returns a new set with the key removed, and a bool indicating if
+// the key was in the set.
+func (s *Set) Remove(k []byte) (*Set, bool) {
+	txn := s.Txn()
+	ok := txn.Remove(k)
+	return txn.Commit(), ok
+}
+
+// Walk is used to walk the keys of the set in order.
+func (s *Set) Walk(fn func(k []byte) bool) {
+	s.WalkPrefix(nil, fn)
+}
+
+// WalkPrefix is used to walk the keys under a prefix in order.
+func (s *Set) WalkPrefix(prefix []byte, fn func(k []byte) bool) {
+	s.tree.Root().WalkPrefix(prefix, func(k []byte, _ struct{}) bool {
+		return fn(k)
+	})
+}
+
+// WalkRange is used to walk the keys in the range [lo, hi) in order. A nil
+// hi walks to the end of the set.
+func (s *Set) WalkRange(lo, hi []byte, fn func(k []byte) bool) {
+	iter := s.tree.Root().Iterator()
+	iter.SeekLowerBound(lo)
+	for k, _, ok := iter.Next(); ok; k, _, ok = iter.Next() {
+		if hi != nil && string(k) >= string(hi) {
+			return
+		}
+		if fn(k) {
+			return
+		}
+	}
+}
+
+// Iterator returns an iterator over the keys of the set.
+func (s *Set) Iterator() *SetIterator {
+	return &SetIterator{i: s.tree.Root().Iterator()}
+}
+
+// ReverseIterator returns a reverse iterator over the keys of the set.
+func (s *Set) ReverseIterator() *SetReverseIterator {
+	return &SetReverseIterator{ri: s.tree.Root().ReverseIterator()}
+}
+
+// Union returns a set with the keys that are in either set.
+func (s *Set) Union(o *Set) *Set {
+	txn := s.Txn()
+	diffNodes(s.tree.root, o.tree.root, func(k []byte, old, _ *leafNode[struct{}]) bool {
+		if old == nil {
+			txn.Add(k)
+		}
+		return false
+	})
+	return txn.Commit()
+}
+
+// Intersect returns a set with the keys that are in both sets.
+func (s *Set) Intersect(o *Set) *Set {
+	txn := s.Txn()
+	diffNodes(s.tree.root, o.tree.root, func(k []byte, _, new *leafNode[struct{}]) bool {
+		if new == nil {
+			txn.Remove(k)
+		}
+		return false
+	})
+	return txn.Commit()
+}
+
+// Difference returns a set with the keys that are in this set but not the
+// other one. The result is built up from the missing keys, so it doesn't
+// share nodes with either set.
+func (s *Set) Difference(o *Set) *Set {
+	txn := NewSet().Txn()
+	diffNodes(s.tree.root, o.tree.root, func(k []byte, _, new *leafNode[struct{}]) bool {
+		if new == nil {
+			txn.Add(k)
+		}
+		return false
+	})
+	return txn.Commit()
+}
+
+// IsSubset returns true if every key in this set is also in the other one.
+func (s *Set) IsSubset(o *Set) bool {
+	if s.Len() > o.Len() {
+		return false
+	}
+	subset := true
+	diffNodes(s.tree.root, o.tree.root, func(_ []byte, _, new *leafNode[struct{}]) bool {
+		subset = new != nil
+		return !subset
+	})
+	return subset
+}
+
+// SetIterator is used to iterate over the keys of a Set in order.
+type SetIterator struct {
+	i *Iterator[struct{}]
+}
+
+// SeekPrefix is used to seek the iterator to a given prefix.
+func (si *SetIterator) SeekPrefix(prefix []byte) {
+	si.i.SeekPrefix(prefix)
+}
+
+// SeekLowerBound is used to seek the iterator to the smallest key that is
+// greater or equal to the given key.
+func (si *SetIterator) SeekLowerBound(key []byte) {
+	si.i.SeekLowerBound(key)
+}
+
+// Next returns the next key in order.
+func (si *SetIterator) Next() ([]byte, bool) {
+	k, _, ok := si.i.Next()
+	return k, ok
+}
+
+// SetReverseIterator is used to iterate over the keys of a Set in reverse
+// order.
+type SetReverseIterator struct {
+	ri *ReverseIterator[struct{}]
+}
+
+// SeekPrefix is used to seek the iterator to a given prefix.
+func (sri *SetReverseIterator) SeekPrefix(prefix []byte) {
+	sri.ri.SeekPrefix(prefix)
+}
+
+// SeekReverseLowerBound is used to seek the iterator to the largest key
+// that is lower or equal to the given key.
+func (sri *SetReverseIterator) SeekReverseLowerBound(key []byte) {
+	sri.ri.SeekReverseLowerBound(key)
+}
+
+// Previous returns the previous key in reverse order.
+func (sri *SetReverseIterator) Previous() ([]byte, bool) {
+	k, _, ok := sri.ri.Previous()
+	return k, ok
+}
+
+// SetTxn is a transaction on a Set, used to batch changes. Like Txn it is
+// not thread safe.
+type SetTxn struct {
+	txn *Txn[struct{}]
+}
+
+// Txn starts a new transaction that can be used to change the set.
+func (s *Set) Txn() *SetTxn {
+	return &SetTxn{txn: s.tree.Txn()}
+}
+
+// TrackMutate can be used to toggle if mutations are tracked, see
+// Txn.TrackMutate.
+func (t *SetTxn) TrackMutate(track bool) {
+	t.txn.TrackMutate(track)
+}
+
+// Len returns the number of keys in the set as of this transaction.
+func (t *SetTxn) Len() int {
+	return t.txn.size
+}
+
+// Contains returns true if the key is in the set.
+func (t *SetTxn) Contains(k []byte) bool {
+	_, ok := t.txn.Get(k)
+	return ok
+}
+
+// GetWatch returns a watch channel that is closed when the key is added to
+// or removed from the set, along with if the key is in the set.
+func (t *SetTxn) GetWatch(k []byte) (<-chan struct{}, bool) {
+	watch, _, ok := t.txn.GetWatch(k)
+	return watch, ok
+}
+
+// Add adds a key to the set, returning true if it was already there. Adding
+// a key that is already there leaves the set unchanged, so it doesn't fire
+// any watches.
+func (t *SetTxn) Add(k []byte) bool {
+	if _, ok := t.txn.Get(k); ok {
+		return true
+	}
+	t.txn.Insert(k, struct{}{})
+	return false
+}
+
+// Remove removes a key from the set, returning true if it was there.
+func (t *SetTxn) Remove(k []byte) bool {
+	_, ok := t.txn.Delete(k)
+	return ok
+}
+
+// RemovePrefix removes every key under the given prefix, returning true if
+// any were removed.
+func (t *SetTxn) RemovePrefix(prefix []byte) bool {
+	return t.txn.DeletePrefix(prefix)
+}
+
+// Commit is used to finalize the transaction and return a new set. If
+// mutation tracking is turned on then notifications will also be issued.
+func (t *SetTxn) Commit() *Set {
+	return &Set{tree: t.txn.Commit()}
+}
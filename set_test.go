@@ -0,0 +1,162 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func setOf(keys ...string) *Set {
+	txn := NewSet().Txn()
+	for _, k := range keys {
+		txn.Add([]byte(k))
+	}
+	return txn.Commit()
+}
+
+func setKeys(s *Set) []string {
+	keys := []string{}
+	s.Walk(func(k []byte) bool {
+		keys = append(keys, string(k))
+		return false
+	})
+	return keys
+}
+
+func TestSet(t *testing.T) {
+	s := setOf("b", "a", "c")
+	s2, ok := s.Add([]byte("d"))
+	if ok || s2.Len() != 4 || s.Len() != 3 {
+		t.Fatalf("bad: %v %d %d", ok, s2.Len(), s.Len())
+	}
+	if _, ok := s2.Add([]byte("a")); !ok {
+		t.Fatalf("a should already be there")
+	}
+	s2, ok = s2.Remove([]byte("b"))
+	if !ok || s2.Contains([]byte("b")) || !s.Contains([]byte("b")) {
+		t.Fatalf("bad remove")
+	}
+	if got := setKeys(s2); !reflect.DeepEqual(got, []string{"a", "c", "d"}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	var keys []string
+	s = setOf("foo/1", "foo/2", "foo/3", "zip")
+	s.WalkRange([]byte("foo/2"), []byte("z"), func(k []byte) bool {
+		keys = append(keys, string(k))
+		return false
+	})
+	if !reflect.DeepEqual(keys, []string{"foo/2", "foo/3"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	iter := s.Iterator()
+	iter.SeekPrefix([]byte("foo/"))
+	if k, ok := iter.Next(); !ok || string(k) != "foo/1" {
+		t.Fatalf("bad: %q", k)
+	}
+	riter := s.ReverseIterator()
+	riter.SeekPrefix([]byte("foo/"))
+	if k, ok := riter.Previous(); !ok || string(k) != "foo/3" {
+		t.Fatalf("bad: %q", k)
+	}
+}
+
+func TestSet_Algebra(t *testing.T) {
+	a := setOf("a", "b", "c", "d")
+	b := setOf("c", "d", "e")
+
+	cases := []struct {
+		got  *Set
+		want []string
+	}{
+		{a.Union(b), []string{"a", "b", "c", "d", "e"}},
+		{a.Intersect(b), []string{"c", "d"}},
+		{a.Difference(b), []string{"a", "b"}},
+		{b.Difference(a), []string{"e"}},
+		{a.Union(NewSet()), []string{"a", "b", "c", "d"}},
+		{a.Intersect(NewSet()), []string{}},
+	}
+	for i, c := range cases {
+		if got := setKeys(c.got); !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("%d: bad: %v", i, got)
+		}
+		if c.got.Len() != len(c.want) {
+			t.Fatalf("%d: bad len: %d", i, c.got.Len())
+		}
+	}
+
+	if !a.Intersect(b).IsSubset(a) || !a.Intersect(b).IsSubset(b) {
+		t.Fatalf("intersection should be a subset of both")
+	}
+	if a.IsSubset(b) || !NewSet().IsSubset(b) {
+		t.Fatalf("bad subset")
+	}
+}
+
+func TestSet_AlgebraShared(t *testing.T) {
+	txn := NewSet().Txn()
+	for i := 0; i < 1000; i++ {
+		txn.Add([]byte(fmt.Sprintf("key/%04d", i)))
+	}
+	a := txn.Commit()
+
+	// b shares nearly all of its nodes with a.
+	txn = a.Txn()
+	txn.Remove([]byte("key/0500"))
+	txn.Add([]byte("key/1500"))
+	b := txn.Commit()
+
+	if u := a.Union(b); u.Len() != 1001 || !u.Contains([]byte("key/0500")) {
+		t.Fatalf("bad union: %d", u.Len())
+	}
+	if i := a.Intersect(b); i.Len() != 999 || i.Contains([]byte("key/1500")) {
+		t.Fatalf("bad intersect: %d", i.Len())
+	}
+	if got := setKeys(a.Difference(b)); !reflect.DeepEqual(got, []string{"key/0500"}) {
+		t.Fatalf("bad difference: %v", got)
+	}
+
+	// Operations on a set and itself skip the whole tree.
+	if a.Union(a).Root() != a.Root() || a.Intersect(a).Root() != a.Root() {
+		t.Fatalf("should not have copied any nodes")
+	}
+	if !a.IsSubset(a) || a.IsSubset(b) {
+		t.Fatalf("bad subset")
+	}
+}
+
+func TestSetTxn_Watch(t *testing.T) {
+	s := setOf("a", "b")
+	txn := s.Txn()
+	txn.TrackMutate(true)
+	watchA, ok := txn.GetWatch([]byte("a"))
+	if !ok {
+		t.Fatalf("a should be found")
+	}
+	watchB, _ := s.GetWatch([]byte("b"))
+
+	// Re-adding an existing key isn't a change.
+	if !txn.Add([]byte("b")) {
+		t.Fatalf("b should already be there")
+	}
+	txn.Remove([]byte("a"))
+	if txn.Len() != 1 || txn.Contains([]byte("a")) {
+		t.Fatalf("bad: %d", txn.Len())
+	}
+	txn.Commit()
+
+	select {
+	case <-watchA:
+	default:
+		t.Fatalf("watch on a should fire")
+	}
+	select {
+	case <-watchB:
+		t.Fatalf("watch on b should not fire")
+	default:
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrCommitConflict is returned when a transaction can't be committed to a
+// Store because another commit landed after the transaction's base was
+// read.
+var ErrCommitConflict = errors.New("iradix: commit conflicts with a newer commit")
+
+// Store holds the current version of a tree and coordinates updates to it.
+// Reads through Snapshot never block, while writers are serialized and each
+// commit publishes its new tree atomically. Mutation notifications are only
+// issued once the new tree is visible to readers, so a watcher that wakes up
+// and calls Snapshot will always see the change that woke it.
+type Store[T any] struct {
+	// root holds the current *Tree[T].
+	root atomic.Value
+
+	// writeLock serializes commits.
+	writeLock sync.Mutex
+}
+
+// NewStore returns a Store whose current tree is t.
+func NewStore[T any](t *Tree[T]) *Store[T] {
+	s := &Store[T]{}
+	s.root.Store(t)
+	return s
+}
+
+// Snapshot returns the current tree. It is safe to call concurrently with
+// writers and never blocks.
+func (s *Store[T]) Snapshot() *Tree[T] {
+	return s.root.Load().(*Tree[T])
+}
+
+// Update runs fn with a transaction on the current tree and commits the
+// result if fn returns nil. Calls to Update are serialized, so fn always
+// sees the latest tree. If fn returns an error nothing is committed and the
+// error is returned. Mutation tracking can be turned on from inside fn with
+// TrackMutate.
+func (s *Store[T]) Update(fn func(txn *Txn[T]) error) (*Tree[T], error) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	txn := s.Snapshot().Txn()
+	if err := fn(txn); err != nil {
+		return nil, err
+	}
+	return s.publish(txn), nil
+}
+
+// CompareAndCommit commits txn, which must have been started from base,
+// provided base is still the current tree. If another commit has landed
+// since then it returns ErrCommitConflict and leaves the Store unchanged.
+// If txn was not started from base, or rebased onto it, an error wrapping
+// ErrCommitConflict is returned and nothing is committed. This allows
+// transactions to be built without holding up other writers, at the cost of
+// retrying them on conflict.
+func (s *Store[T]) CompareAndCommit(base *Tree[T], txn *Txn[T]) (*Tree[T], error) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	if s.Snapshot() != base {
+		return nil, ErrCommitConflict
+	}
+	if txn.snap != base.root {
+		return nil, fmt.Errorf("%w: transaction was not started from base", ErrCommitConflict)
+	}
+	return s.publish(txn), nil
+}
+
+// Txn starts a transaction on the current tree with read and operation
+// tracking turned on, for use with Commit, or with CompareAndCommit and
+// Rebase.
+func (s *Store[T]) Txn() *Txn[T] {
+	txn := s.Snapshot().Txn()
+	txn.TrackReads(true)
+	txn.TrackOps(true)
+	return txn
+}
+
+// Commit commits a transaction that was started from any earlier tree in
+// the Store, without requiring that no other commits landed in between.
+// If the transaction is tracking reads, they are checked against the keys
+// changed by those commits and an error wrapping ErrCommitConflict is
+// returned if any of them were invalidated. A DeletePrefix counts as a
+// read of everything under the prefix. Otherwise the transaction's writes
+// are applied on top of the current tree, so writers that touch disjoint
+// keys never have to retry. Writes that weren't preceded by a read of the
+// same key are applied blindly, with the last commit winning.
+//
+// Transactions that record their operations, like those from Txn, have
+// them replayed onto the current tree, so as with Rebase the operations
+// should be recorded from the start. For other transactions the keys that
+// differ from the tree they started from are applied instead, so a
+// DeletePrefix only removes the keys that existed when they started.
+func (s *Store[T]) Commit(txn *Txn[T]) (*Tree[T], error) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	cur := s.Snapshot()
+	if cur.root == txn.snap {
+		return s.publish(txn), nil
+	}
+	if err := txn.validateReads(cur.root); err != nil {
+		return nil, err
+	}
+
+	// Move the transaction's writes over to the current tree, replaying
+	// them if they were recorded. Otherwise only the leaves that differ
+	// from the snapshot it started from need to be applied.
+	mtxn := cur.Txn()
+	mtxn.TrackMutate(txn.trackMutate)
+	if txn.trackOps {
+		mtxn.replayOps(txn.ops)
+		return s.publish(mtxn), nil
+	}
+	diffNodes(txn.snap, txn.root, func(k []byte, _, new *leafNode[T]) bool {
+		if new == nil {
+			mtxn.Delete(k)
+		} else {
+			mtxn.Insert(k, new.val)
+		}
+		return false
+	})
+	return s.publish(mtxn), nil
+}
+
+// publish commits txn, makes the new tree current and then issues any
+// notifications. It must be called with the write lock held so that
+// notifications go out in commit order.
+func (s *Store[T]) publish(txn *Txn[T]) *Tree[T] {
+	nt := txn.CommitOnly()
+	s.root.Store(nt)
+	txn.Notify()
+	return nt
+}
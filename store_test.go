@@ -0,0 +1,115 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestStore_Update(t *testing.T) {
+	s := NewStore(New[int]())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := s.Update(func(txn *Txn[int]) error {
+					n, _ := txn.Get([]byte("counter"))
+					txn.Insert([]byte("counter"), n+1)
+					txn.Insert([]byte(fmt.Sprintf("%d/%d", i, j)), j)
+					return nil
+				})
+				if err != nil {
+					t.Errorf("err: %v", err)
+				}
+			}
+		}(i)
+	}
+
+	// Readers run alongside the writers and should always see a
+	// consistent tree.
+	for i := 0; i < 100; i++ {
+		snap := s.Snapshot()
+		n, _ := snap.Get([]byte("counter"))
+		if snap.Len() != 0 && snap.Len() != n+1 {
+			t.Fatalf("inconsistent snapshot: %d %d", snap.Len(), n)
+		}
+	}
+	wg.Wait()
+
+	if n, _ := s.Snapshot().Get([]byte("counter")); n != 800 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	expect := errors.New("nope")
+	before := s.Snapshot()
+	_, err := s.Update(func(txn *Txn[int]) error {
+		txn.Insert([]byte("counter"), 0)
+		return expect
+	})
+	if err != expect || s.Snapshot() != before {
+		t.Fatalf("failed update should not commit: %v", err)
+	}
+}
+
+func TestStore_CompareAndCommit(t *testing.T) {
+	s := NewStore(New[int]())
+
+	base := s.Snapshot()
+	txn1 := base.Txn()
+	txn1.Insert([]byte("foo"), 1)
+	txn2 := base.Txn()
+	txn2.Insert([]byte("foo"), 2)
+
+	nt, err := s.CompareAndCommit(base, txn1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if s.Snapshot() != nt {
+		t.Fatalf("commit not published")
+	}
+	if _, err := s.CompareAndCommit(base, txn2); err != ErrCommitConflict {
+		t.Fatalf("expected conflict, got: %v", err)
+	}
+	if v, _ := s.Snapshot().Get([]byte("foo")); v != 1 {
+		t.Fatalf("bad: %d", v)
+	}
+
+	// A txn from an older tree can't be committed against the current one.
+	if _, err := s.CompareAndCommit(nt, txn2); !errors.Is(err, ErrCommitConflict) {
+		t.Fatalf("expected conflict, got: %v", err)
+	}
+	if s.Snapshot() != nt {
+		t.Fatalf("stale txn should not commit")
+	}
+}
+
+func TestStore_NotifyAfterPublish(t *testing.T) {
+	s := NewStore(New[int]())
+	watch, _, _ := s.Snapshot().Root().GetWatch([]byte("foo"))
+
+	done := make(chan int)
+	go func() {
+		<-watch
+		v, _ := s.Snapshot().Get([]byte("foo"))
+		done <- v
+	}()
+
+	_, err := s.Update(func(txn *Txn[int]) error {
+		txn.TrackMutate(true)
+		txn.Insert([]byte("foo"), 42)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if v := <-done; v != 42 {
+		t.Fatalf("watcher saw stale tree: %d", v)
+	}
+}
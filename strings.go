@@ -0,0 +1,106 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import "unsafe"
+
+// The methods in this file take and return keys as strings without copying
+// them. Leaves own a copy of their key, which the tree never modifies, so
+// strings returned share memory with it. Strings passed in are converted
+// only to be read, which the compiler does without copying.
+
+// bytesString returns a string that shares memory with b, which must never
+// be modified.
+func bytesString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
+
+// GetString is like Get, but takes a string key.
+func (n *Node[T]) GetString(k string) (T, bool) {
+	return n.Get([]byte(k))
+}
+
+// LongestPrefixString is like LongestPrefix, but takes and returns string
+// keys.
+func (n *Node[T]) LongestPrefixString(k string) (string, T, bool) {
+	m, v, ok := n.LongestPrefix([]byte(k))
+	return bytesString(m), v, ok
+}
+
+// WalkStringFn is used when walking the tree with string keys. Takes a key
+// and value, returning if iteration should be terminated.
+type WalkStringFn[T any] func(k string, v T) bool
+
+// WalkString is like Walk, but passes string keys to fn.
+func (n *Node[T]) WalkString(fn WalkStringFn[T]) {
+	n.WalkPrefixString("", fn)
+}
+
+// WalkPrefixString is like WalkPrefix, but takes a string prefix and passes
+// string keys to fn.
+func (n *Node[T]) WalkPrefixString(prefix string, fn WalkStringFn[T]) {
+	n.WalkPrefix([]byte(prefix), func(k []byte, v T) bool {
+		return fn(bytesString(k), v)
+	})
+}
+
+// GetString is like Get, but takes a string key.
+func (t *Tree[T]) GetString(k string) (T, bool) {
+	return t.root.GetString(k)
+}
+
+// StringIterator is like Iterator, but takes and returns string keys.
+type StringIterator[T any] struct {
+	i *Iterator[T]
+}
+
+// StringIterator returns a StringIterator at the node.
+func (n *Node[T]) StringIterator() *StringIterator[T] {
+	return &StringIterator[T]{i: n.Iterator()}
+}
+
+// SeekPrefix is used to seek the iterator to a given prefix.
+func (si *StringIterator[T]) SeekPrefix(prefix string) {
+	si.i.SeekPrefix([]byte(prefix))
+}
+
+// SeekLowerBound is used to seek the iterator to the smallest key that is
+// greater or equal to the given key.
+func (si *StringIterator[T]) SeekLowerBound(key string) {
+	si.i.SeekLowerBound([]byte(key))
+}
+
+// Next returns the next node in order.
+func (si *StringIterator[T]) Next() (string, T, bool) {
+	k, v, ok := si.i.Next()
+	return bytesString(k), v, ok
+}
+
+// StringReverseIterator is like ReverseIterator, but takes and returns
+// string keys.
+type StringReverseIterator[T any] struct {
+	ri *ReverseIterator[T]
+}
+
+// StringReverseIterator returns a StringReverseIterator at the node.
+func (n *Node[T]) StringReverseIterator() *StringReverseIterator[T] {
+	return &StringReverseIterator[T]{ri: n.ReverseIterator()}
+}
+
+// SeekPrefix is used to seek the iterator to a given prefix.
+func (sri *StringReverseIterator[T]) SeekPrefix(prefix string) {
+	sri.ri.SeekPrefix([]byte(prefix))
+}
+
+// SeekReverseLowerBound is used to seek the iterator to the largest key
+// that is lower or equal to the given key.
+func (sri *StringReverseIterator[T]) SeekReverseLowerBound(key string) {
+	sri.ri.SeekReverseLowerBound([]byte(key))
+}
+
+// Previous returns the previous node in reverse order.
+func (sri *StringReverseIterator[T]) Previous() (string, T, bool) {
+	k, v, ok := sri.ri.Previous()
+	return bytesString(k), v, ok
+}
@@ -0,0 +1,239 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func stringFixture() *Tree[int] {
+	txn := New[int]().Txn()
+	for i, k := range []string{"", "foo", "foo/bar", "foo/baz", "zip"} {
+		txn.Insert([]byte(k), i)
+	}
+	return txn.Commit()
+}
+
+func TestNode_StringKeys(t *testing.T) {
+	r := stringFixture()
+	if v, ok := r.GetString("foo/bar"); !ok || v != 2 {
+		t.Fatalf("bad: %v", v)
+	}
+	if v, ok := r.Root().GetString(""); !ok || v != 0 {
+		t.Fatalf("bad: %v", v)
+	}
+	if _, ok := r.GetString("foo/"); ok {
+		t.Fatalf("should not be found")
+	}
+	if k, v, ok := r.Root().LongestPrefixString("foo/qux"); !ok || k != "foo" || v != 1 {
+		t.Fatalf("bad: %q %v", k, v)
+	}
+
+	var keys []string
+	r.Root().WalkPrefixString("foo/", func(k string, _ int) bool {
+		keys = append(keys, k)
+		return false
+	})
+	if !reflect.DeepEqual(keys, []string{"foo/bar", "foo/baz"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	keys = nil
+	r.Root().WalkString(func(k string, _ int) bool {
+		keys = append(keys, k)
+		return false
+	})
+	if !reflect.DeepEqual(keys, []string{"", "foo", "foo/bar", "foo/baz", "zip"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+}
+
+func TestNode_StringIterators(t *testing.T) {
+	r := stringFixture()
+
+	iter := r.Root().StringIterator()
+	iter.SeekLowerBound("foo/bas")
+	var keys []string
+	for k, _, ok := iter.Next(); ok; k, _, ok = iter.Next() {
+		keys = append(keys, k)
+	}
+	if !reflect.DeepEqual(keys, []string{"foo/baz", "zip"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	iter = r.Root().StringIterator()
+	iter.SeekPrefix("foo/")
+	if k, _, _ := iter.Next(); k != "foo/bar" {
+		t.Fatalf("bad: %q", k)
+	}
+
+	riter := r.Root().StringReverseIterator()
+	riter.SeekReverseLowerBound("foo/bas")
+	keys = nil
+	for k, _, ok := riter.Previous(); ok; k, _, ok = riter.Previous() {
+		keys = append(keys, k)
+	}
+	if !reflect.DeepEqual(keys, []string{"foo/bar", "foo", ""}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	riter = r.Root().StringReverseIterator()
+	riter.SeekPrefix("foo/")
+	if k, _, _ := riter.Previous(); k != "foo/baz" {
+		t.Fatalf("bad: %q", k)
+	}
+}
+
+func TestNode_StringKeysAllocs(t *testing.T) {
+	r := benchStringTree(1000)
+	root := r.Root()
+	key := fmt.Sprintf("service/%05d/health", 500)
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, ok := root.GetString(key); !ok {
+			t.Fatalf("missing %q", key)
+		}
+		if _, _, ok := root.LongestPrefixString(key + "/check"); !ok {
+			t.Fatalf("missing prefix of %q", key)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("bad: %v allocs", allocs)
+	}
+
+	// Walks and iterators don't allocate for each key either.
+	fn := func(string, int) bool { return false }
+	allocs = testing.AllocsPerRun(100, func() {
+		root.WalkPrefixString("service/00", fn)
+	})
+	if allocs != 0 {
+		t.Fatalf("bad: %v allocs", allocs)
+	}
+	iter := root.StringIterator()
+	riter := root.StringReverseIterator()
+	allocs = testing.AllocsPerRun(100, func() {
+		iter.Next()
+		riter.Previous()
+	})
+	if allocs != 0 {
+		t.Fatalf("bad: %v allocs", allocs)
+	}
+}
+
+func TestNode_StringKeysCopied(t *testing.T) {
+	// Inserted keys are copied, so keys returned as strings must not change
+	// along with the slice that was inserted.
+	key := []byte("foo")
+	txn := New[int]().Txn()
+	txn.Insert(key, 1)
+	root := txn.Commit().Root()
+
+	k, _, _ := root.LongestPrefixString("foo/bar")
+	var walked string
+	root.WalkString(func(k string, _ int) bool {
+		walked = k
+		return false
+	})
+	iter := root.StringIterator()
+	next, _, _ := iter.Next()
+
+	copy(key, "bar")
+	for _, got := range []string{k, walked, next} {
+		if got != "foo" {
+			t.Fatalf("bad: %q", got)
+		}
+	}
+}
+
+func benchStringTree(n int) *Tree[int] {
+	txn := New[int]().Txn()
+	for i := 0; i < n; i++ {
+		txn.Insert([]byte(fmt.Sprintf("service/%05d/health", i)), i)
+	}
+	return txn.Commit()
+}
+
+func BenchmarkGetString(b *testing.B) {
+	root := benchStringTree(10000).Root()
+	key := fmt.Sprintf("service/%05d/health/extra/long/suffix", 5000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.GetString(key)
+	}
+}
+
+func BenchmarkWalkPrefixString(b *testing.B) {
+	root := benchStringTree(10000).Root()
+	keys := make([]string, 0, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		keys = keys[:0]
+		root.WalkPrefixString("service/05", func(k string, _ int) bool {
+			keys = append(keys, k)
+			return false
+		})
+	}
+}
+
+func BenchmarkWalkPrefix_StringConversion(b *testing.B) {
+	root := benchStringTree(10000).Root()
+	keys := make([]string, 0, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		keys = keys[:0]
+		root.WalkPrefix([]byte("service/05"), func(k []byte, _ int) bool {
+			keys = append(keys, string(k))
+			return false
+		})
+	}
+}
+
+func BenchmarkIterator_StringConversion(b *testing.B) {
+	root := benchStringTree(10000).Root()
+	keys := make([]string, 0, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		keys = keys[:0]
+		iter := root.Iterator()
+		iter.SeekPrefix([]byte("service/05"))
+		for k, _, ok := iter.Next(); ok; k, _, ok = iter.Next() {
+			keys = append(keys, string(k))
+		}
+	}
+}
+
+func BenchmarkStringIterator(b *testing.B) {
+	root := benchStringTree(10000).Root()
+	keys := make([]string, 0, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		keys = keys[:0]
+		iter := root.StringIterator()
+		iter.SeekPrefix("service/05")
+		for k, _, ok := iter.Next(); ok; k, _, ok = iter.Next() {
+			keys = append(keys, k)
+		}
+	}
+}
+
+func BenchmarkStringReverseIterator(b *testing.B) {
+	root := benchStringTree(10000).Root()
+	keys := make([]string, 0, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		keys = keys[:0]
+		iter := root.StringReverseIterator()
+		iter.SeekPrefix("service/05")
+		for k, _, ok := iter.Previous(); ok; k, _, ok = iter.Previous() {
+			keys = append(keys, k)
+		}
+	}
+}
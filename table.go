@@ -0,0 +1,319 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// PrimaryIndex is the name of a Table's index on the objects' IDs.
+const PrimaryIndex = "id"
+
+// ErrUnknownIndex is returned when a Table is queried by an index it
+// doesn't have.
+var ErrUnknownIndex = errors.New("iradix: unknown index")
+
+// Indexer returns the keys that an object is indexed under in a secondary
+// index. An object may have any number of keys, including none, in which
+// case it isn't found through the index.
+type Indexer[T any] func(obj T) [][]byte
+
+// tableSchema holds the parts of a Table that never change.
+type tableSchema[T any] struct {
+	id       func(obj T) []byte
+	indexers map[string]Indexer[T]
+	names    []string
+}
+
+// Table is an immutable collection of objects with a primary index by ID
+// and any number of secondary indexes, each stored in its own tree. The
+// secondary indexes are kept consistent with the objects by TableTxn.
+//
+// Secondary index entries are keyed by the escaped index key followed by
+// the object's ID, so that several objects can share an index key, and they
+// hold the object itself so that lookups don't need to go back to the
+// primary index.
+type Table[T any] struct {
+	schema  *tableSchema[T]
+	primary *Tree[T]
+	indexes map[string]*Tree[T]
+}
+
+// NewTable returns an empty table whose objects are identified by id and
+// indexed by the given indexers. It panics if an index is named
+// PrimaryIndex.
+func NewTable[T any](id func(obj T) []byte, indexers map[string]Indexer[T]) *Table[T] {
+	schema := &tableSchema[T]{id: id, indexers: make(map[string]Indexer[T])}
+	indexes := make(map[string]*Tree[T])
+	for name, indexer := range indexers {
+		if name == PrimaryIndex {
+			panic(fmt.Sprintf("iradix: index name %q is reserved", PrimaryIndex))
+		}
+		schema.indexers[name] = indexer
+		schema.names = append(schema.names, name)
+		indexes[name] = New[T]()
+	}
+	sort.Strings(schema.names)
+	return &Table[T]{schema: schema, primary: New[T](), indexes: indexes}
+}
+
+// Len returns the number of objects in the table.
+func (t *Table[T]) Len() int {
+	return t.primary.Len()
+}
+
+// Get returns the object with the given ID, and if it was found.
+func (t *Table[T]) Get(id []byte) (T, bool) {
+	return t.primary.Get(id)
+}
+
+// GetWatch returns the object with the given ID, and if it was found, along
+// with a watch channel that is closed when the object changes.
+func (t *Table[T]) GetWatch(id []byte) (<-chan struct{}, T, bool) {
+	return t.primary.Root().GetWatch(id)
+}
+
+// Lookup returns an iterator over the objects with the given key in the
+// named index, in ID order, and a watch channel that is closed when the
+// results change.
+func (t *Table[T]) Lookup(index string, key []byte) (*TableIterator[T], <-chan struct{}, error) {
+	return tableLookup(t.root(index), index, key)
+}
+
+// Prefix returns an iterator over the objects whose key in the named index
+// starts with the given prefix, in index order, and a watch channel that is
+// closed when the results change.
+func (t *Table[T]) Prefix(index string, prefix []byte) (*TableIterator[T], <-chan struct{}, error) {
+	return tablePrefix(t.root(index), index, prefix)
+}
+
+// Range returns an iterator over the objects whose key in the named index
+// is in [lo, hi), in index order. A nil hi ranges to the end of the index.
+// The watch channel is closed when anything in the index changes.
+func (t *Table[T]) Range(index string, lo, hi []byte) (*TableIterator[T], <-chan struct{}, error) {
+	return tableRange(t.root(index), index, lo, hi)
+}
+
+// root returns the root of the named index, or nil if there isn't one.
+func (t *Table[T]) root(index string) *Node[T] {
+	if index == PrimaryIndex {
+		return t.primary.Root()
+	}
+	if tree, ok := t.indexes[index]; ok {
+		return tree.Root()
+	}
+	return nil
+}
+
+// indexEntryKey returns the key of an object's entry in a secondary index.
+func indexEntryKey(key, id []byte) []byte {
+	return append(escapeKey(key), id...)
+}
+
+// escapedPrefix returns the escaped form of a key prefix, which is a prefix
+// of the escaped form of every key that starts with it.
+func escapedPrefix(prefix []byte) []byte {
+	ek := escapeKey(prefix)
+	return ek[:len(ek)-2]
+}
+
+func tableLookup[T any](root *Node[T], index string, key []byte) (*TableIterator[T], <-chan struct{}, error) {
+	if root == nil {
+		return nil, nil, ErrUnknownIndex
+	}
+	if index == PrimaryIndex {
+		// IDs are unique, so an exact lookup is the range of just the ID.
+		watch, _, _ := root.GetWatch(key)
+		iter := root.Iterator()
+		iter.SeekLowerBound(key)
+		return &TableIterator[T]{i: iter, hi: append(append([]byte{}, key...), 0)}, watch, nil
+	}
+	iter := root.Iterator()
+	watch := iter.SeekPrefixWatch(escapeKey(key))
+	return &TableIterator[T]{i: iter}, watch, nil
+}
+
+func tablePrefix[T any](root *Node[T], index string, prefix []byte) (*TableIterator[T], <-chan struct{}, error) {
+	if root == nil {
+		return nil, nil, ErrUnknownIndex
+	}
+	if index != PrimaryIndex {
+		prefix = escapedPrefix(prefix)
+	}
+	iter := root.Iterator()
+	watch := iter.SeekPrefixWatch(prefix)
+	return &TableIterator[T]{i: iter}, watch, nil
+}
+
+func tableRange[T any](root *Node[T], index string, lo, hi []byte) (*TableIterator[T], <-chan struct{}, error) {
+	if root == nil {
+		return nil, nil, ErrUnknownIndex
+	}
+	if index != PrimaryIndex {
+		lo = escapeKey(lo)
+		if hi != nil {
+			hi = escapeKey(hi)
+		}
+	}
+	iter := root.Iterator()
+	iter.SeekLowerBound(lo)
+	return &TableIterator[T]{i: iter, hi: hi}, root.mutateCh.get(), nil
+}
+
+// TableIterator is used to iterate over the results of a Table query.
+type TableIterator[T any] struct {
+	i *Iterator[T]
+
+	// hi is the exclusive upper bound of the entry keys, or nil if there
+	// isn't one.
+	hi   []byte
+	done bool
+}
+
+// Next returns the next object.
+func (ti *TableIterator[T]) Next() (T, bool) {
+	var zero T
+	if ti.done {
+		return zero, false
+	}
+	k, v, ok := ti.i.Next()
+	if !ok || (ti.hi != nil && bytes.Compare(k, ti.hi) >= 0) {
+		ti.done = true
+		return zero, false
+	}
+	return v, true
+}
+
+// TableTxn is a transaction on a Table that keeps the secondary indexes
+// consistent with the objects. Like Txn it is not thread safe.
+type TableTxn[T any] struct {
+	schema  *tableSchema[T]
+	primary *Txn[T]
+	indexes map[string]*Txn[T]
+}
+
+// Txn starts a new transaction that can be used to mutate the table.
+func (t *Table[T]) Txn() *TableTxn[T] {
+	txn := &TableTxn[T]{
+		schema:  t.schema,
+		primary: t.primary.Txn(),
+		indexes: make(map[string]*Txn[T], len(t.indexes)),
+	}
+	for name, tree := range t.indexes {
+		txn.indexes[name] = tree.Txn()
+	}
+	return txn
+}
+
+// TrackMutate can be used to toggle if mutations are tracked, see
+// Txn.TrackMutate. It applies to every index.
+func (t *TableTxn[T]) TrackMutate(track bool) {
+	t.primary.TrackMutate(track)
+	for _, txn := range t.indexes {
+		txn.TrackMutate(track)
+	}
+}
+
+// Get returns the object with the given ID, and if it was found.
+func (t *TableTxn[T]) Get(id []byte) (T, bool) {
+	return t.primary.Get(id)
+}
+
+// GetWatch returns the object with the given ID, and if it was found, along
+// with a watch channel that is closed when the object changes.
+func (t *TableTxn[T]) GetWatch(id []byte) (<-chan struct{}, T, bool) {
+	return t.primary.GetWatch(id)
+}
+
+// Lookup is like Table.Lookup, but reads the current state of the
+// transaction. Like Txn.Root, the iterator is not safe across changes.
+func (t *TableTxn[T]) Lookup(index string, key []byte) (*TableIterator[T], <-chan struct{}, error) {
+	return tableLookup(t.root(index), index, key)
+}
+
+// Prefix is like Table.Prefix, but reads the current state of the
+// transaction. Like Txn.Root, the iterator is not safe across changes.
+func (t *TableTxn[T]) Prefix(index string, prefix []byte) (*TableIterator[T], <-chan struct{}, error) {
+	return tablePrefix(t.root(index), index, prefix)
+}
+
+// Range is like Table.Range, but reads the current state of the
+// transaction. Like Txn.Root, the iterator is not safe across changes.
+func (t *TableTxn[T]) Range(index string, lo, hi []byte) (*TableIterator[T], <-chan struct{}, error) {
+	return tableRange(t.root(index), index, lo, hi)
+}
+
+func (t *TableTxn[T]) root(index string) *Node[T] {
+	if index == PrimaryIndex {
+		return t.primary.Root()
+	}
+	if txn, ok := t.indexes[index]; ok {
+		return txn.Root()
+	}
+	return nil
+}
+
+// Insert adds or updates an object, updating every index. The return
+// provides the previous object with the same ID and a bool indicating if
+// there was one.
+func (t *TableTxn[T]) Insert(obj T) (T, bool) {
+	id := t.schema.id(obj)
+	old, ok := t.primary.Insert(id, obj)
+	for _, name := range t.schema.names {
+		indexer, txn := t.schema.indexers[name], t.indexes[name]
+
+		newKeys := make(map[string]struct{})
+		for _, key := range indexer(obj) {
+			newKeys[string(key)] = struct{}{}
+		}
+		if ok {
+			for _, key := range indexer(old) {
+				if _, keep := newKeys[string(key)]; !keep {
+					txn.Delete(indexEntryKey(key, id))
+				}
+			}
+		}
+		for key := range newKeys {
+			txn.Insert(indexEntryKey([]byte(key), id), obj)
+		}
+	}
+	return old, ok
+}
+
+// Delete removes the object with the given ID from every index. Returns the
+// old object if any, and a bool indicating if there was one.
+func (t *TableTxn[T]) Delete(id []byte) (T, bool) {
+	old, ok := t.primary.Delete(id)
+	if !ok {
+		return old, false
+	}
+	for _, name := range t.schema.names {
+		for _, key := range t.schema.indexers[name](old) {
+			t.indexes[name].Delete(indexEntryKey(key, id))
+		}
+	}
+	return old, true
+}
+
+// Commit is used to finalize the transaction and return a new table. If
+// mutation tracking is turned on then notifications will be issued once
+// every index has been committed.
+func (t *TableTxn[T]) Commit() *Table[T] {
+	nt := &Table[T]{
+		schema:  t.schema,
+		primary: t.primary.CommitOnly(),
+		indexes: make(map[string]*Tree[T], len(t.indexes)),
+	}
+	for name, txn := range t.indexes {
+		nt.indexes[name] = txn.CommitOnly()
+	}
+	t.primary.Notify()
+	for _, txn := range t.indexes {
+		txn.Notify()
+	}
+	return nt
+}
@@ -0,0 +1,139 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"reflect"
+	"testing"
+)
+
+type tableObj struct {
+	ID   string
+	Name string
+	Tags []string
+}
+
+func testTable() *Table[*tableObj] {
+	return NewTable(
+		func(o *tableObj) []byte { return []byte(o.ID) },
+		map[string]Indexer[*tableObj]{
+			"name": func(o *tableObj) [][]byte { return [][]byte{[]byte(o.Name)} },
+			"tag": func(o *tableObj) [][]byte {
+				var out [][]byte
+				for _, tag := range o.Tags {
+					out = append(out, []byte(tag))
+				}
+				return out
+			},
+		},
+	)
+}
+
+func tableIDs(t *testing.T, iter *TableIterator[*tableObj], err error) []string {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	ids := []string{}
+	for o, ok := iter.Next(); ok; o, ok = iter.Next() {
+		ids = append(ids, o.ID)
+	}
+	return ids
+}
+
+func TestTable(t *testing.T) {
+	tbl := testTable()
+	txn := tbl.Txn()
+	txn.Insert(&tableObj{ID: "1", Name: "alice", Tags: []string{"admin", "dev"}})
+	txn.Insert(&tableObj{ID: "2", Name: "bob", Tags: []string{"dev"}})
+	txn.Insert(&tableObj{ID: "3", Name: "alina"})
+	txn.Insert(&tableObj{ID: "10", Name: "carol", Tags: []string{"ops"}})
+	tbl = txn.Commit()
+
+	if tbl.Len() != 4 {
+		t.Fatalf("bad len: %d", tbl.Len())
+	}
+	iter, _, err := tbl.Lookup("tag", []byte("dev"))
+	if got := tableIDs(t, iter, err); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Fatalf("bad: %v", got)
+	}
+	iter, _, err = tbl.Lookup(PrimaryIndex, []byte("1"))
+	if got := tableIDs(t, iter, err); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Fatalf("bad: %v", got)
+	}
+	iter, _, err = tbl.Prefix("name", []byte("ali"))
+	if got := tableIDs(t, iter, err); !reflect.DeepEqual(got, []string{"1", "3"}) {
+		t.Fatalf("bad: %v", got)
+	}
+	iter, _, err = tbl.Range("name", []byte("alina"), []byte("carol"))
+	if got := tableIDs(t, iter, err); !reflect.DeepEqual(got, []string{"3", "2"}) {
+		t.Fatalf("bad: %v", got)
+	}
+	iter, _, err = tbl.Range(PrimaryIndex, []byte("10"), nil)
+	if got := tableIDs(t, iter, err); !reflect.DeepEqual(got, []string{"10", "2", "3"}) {
+		t.Fatalf("bad: %v", got)
+	}
+	if _, _, err := tbl.Lookup("nope", nil); err != ErrUnknownIndex {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// Updating an object moves its index entries, and deleting one removes
+	// them.
+	txn = tbl.Txn()
+	old, ok := txn.Insert(&tableObj{ID: "1", Name: "alice", Tags: []string{"ops"}})
+	if !ok || old.Tags[0] != "admin" {
+		t.Fatalf("bad: %v", old)
+	}
+	txn.Delete([]byte("10"))
+	iter, _, err = txn.Lookup("tag", []byte("ops"))
+	if got := tableIDs(t, iter, err); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Fatalf("bad: %v", got)
+	}
+	tbl2 := txn.Commit()
+
+	if n := tbl2.Len(); n != 3 {
+		t.Fatalf("bad len: %d", n)
+	}
+	for name, want := range map[string]int{"name": 3, "tag": 2} {
+		if n := tbl2.indexes[name].Len(); n != want {
+			t.Fatalf("bad %s len: %d", name, n)
+		}
+	}
+	iter, _, err = tbl.Lookup("tag", []byte("admin"))
+	if got := tableIDs(t, iter, err); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Fatalf("old table changed: %v", got)
+	}
+}
+
+func TestTable_Watch(t *testing.T) {
+	txn := testTable().Txn()
+	txn.Insert(&tableObj{ID: "1", Name: "alice", Tags: []string{"dev"}})
+	txn.Insert(&tableObj{ID: "2", Name: "bob", Tags: []string{"ops"}})
+	tbl := txn.Commit()
+
+	_, devWatch, err := tbl.Lookup("tag", []byte("dev"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	_, opsWatch, _ := tbl.Lookup("tag", []byte("ops"))
+	idWatch, _, _ := tbl.GetWatch([]byte("1"))
+
+	txn = tbl.Txn()
+	txn.TrackMutate(true)
+	txn.Insert(&tableObj{ID: "1", Name: "alice", Tags: []string{"dev", "new"}})
+	txn.Commit()
+
+	for name, ch := range map[string]<-chan struct{}{"dev": devWatch, "id": idWatch} {
+		select {
+		case <-ch:
+		default:
+			t.Fatalf("%s watch should fire", name)
+		}
+	}
+	select {
+	case <-opsWatch:
+		t.Fatalf("ops watch should not fire")
+	default:
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tuple
+
+import iradix "github.com/hashicorp/go-immutable-radix/v2"
+
+// Iterator iterates over the keys of a tree that extend a partial tuple,
+// decoding each key as it goes.
+type Iterator[V any] struct {
+	iter   *iradix.Iterator[V]
+	prefix []byte
+	done   bool
+	err    error
+}
+
+// ScanTuplePrefix returns an iterator over the entries under root whose
+// keys are tuples that start with the elements of prefix, in key order.
+func ScanTuplePrefix[V any](root *iradix.Node[V], prefix T) *Iterator[V] {
+	p := prefix.Pack()
+	iter := root.Iterator()
+	iter.SeekPrefix(p)
+	return &Iterator[V]{iter: iter, prefix: p}
+}
+
+// Next returns the next entry with its key decoded. Iteration stops at the
+// first key that isn't a valid tuple, which is then reported by Err.
+func (i *Iterator[V]) Next() (T, V, bool) {
+	var zero V
+	if i.err != nil || i.done {
+		return nil, zero, false
+	}
+	k, v, ok := i.iter.Next()
+	if !ok {
+		return nil, zero, false
+	}
+
+	// The packed prefix ends in a terminator when its last element is a
+	// string, bytes or a nested tuple. Keys that go on with an escape
+	// byte there extend that element rather than the tuple, and since the
+	// escape byte sorts last they come after every key that belongs.
+	if len(k) > len(i.prefix) && k[len(i.prefix)] == escape {
+		i.done = true
+		return nil, zero, false
+	}
+	t, err := Unpack(k)
+	if err != nil {
+		i.err = err
+		return nil, zero, false
+	}
+	return t, v, true
+}
+
+// Err returns the error that stopped iteration, if any.
+func (i *Iterator[V]) Err() error {
+	return i.err
+}
+
+// WalkTuplePrefix calls fn for every entry under root whose key is a tuple
+// that starts with the elements of prefix, in key order, until fn returns
+// true. It returns an error if a key isn't a valid tuple.
+func WalkTuplePrefix[V any](root *iradix.Node[V], prefix T, fn func(t T, v V) bool) error {
+	iter := ScanTuplePrefix(root, prefix)
+	for t, v, ok := iter.Next(); ok; t, v, ok = iter.Next() {
+		if fn(t, v) {
+			break
+		}
+	}
+	return iter.Err()
+}
@@ -0,0 +1,279 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Package tuple encodes tuples of strings, integers, byte slices and nested
+// tuples into keys for an iradix tree. The encoding follows the FoundationDB
+// tuple layer: encoded tuples sort in the same order as the tuples, element
+// by element, and the encoding of a tuple is a prefix of the encoding of any
+// longer tuple that starts with the same elements, so a partial tuple can be
+// used to scan every key that extends it.
+package tuple
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrInvalid is returned when bytes can't be decoded as a tuple.
+var ErrInvalid = errors.New("tuple: invalid encoding")
+
+// T is a tuple. Its elements may be nil, []byte, string, any signed or
+// unsigned integer type, or a nested T.
+type T []any
+
+// Type codes of the encoded elements. Integers use the codes from intZero-8
+// to intZero+8, where the distance from intZero is the number of bytes of
+// the value, negative for negative values.
+const (
+	nilCode    = 0x00
+	bytesCode  = 0x01
+	stringCode = 0x02
+	nestedCode = 0x05
+	intZero    = 0x14
+
+	// escape follows a 0x00 inside bytes, strings and nested tuples, so
+	// that it can't be mistaken for a terminator.
+	escape = 0xff
+)
+
+// Pack returns the encoding of the tuple. It panics if the tuple holds an
+// element of an unsupported type.
+func (t T) Pack() []byte {
+	return t.encode(nil, false)
+}
+
+// String returns a readable form of the tuple.
+func (t T) String() string {
+	var buf bytes.Buffer
+	buf.WriteByte('(')
+	for i, e := range t {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		switch e := e.(type) {
+		case nil:
+			buf.WriteString("nil")
+		case string:
+			fmt.Fprintf(&buf, "%q", e)
+		case []byte:
+			fmt.Fprintf(&buf, "b%q", e)
+		default:
+			fmt.Fprint(&buf, e)
+		}
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+func (t T) encode(dst []byte, nested bool) []byte {
+	for _, e := range t {
+		switch e := e.(type) {
+		case nil:
+			dst = append(dst, nilCode)
+			if nested {
+				dst = append(dst, escape)
+			}
+		case []byte:
+			dst = appendEscaped(append(dst, bytesCode), e)
+		case string:
+			dst = appendEscaped(append(dst, stringCode), []byte(e))
+		case T:
+			dst = e.encode(append(dst, nestedCode), true)
+			dst = append(dst, 0x00)
+		case int:
+			dst = appendInt(dst, int64(e))
+		case int8:
+			dst = appendInt(dst, int64(e))
+		case int16:
+			dst = appendInt(dst, int64(e))
+		case int32:
+			dst = appendInt(dst, int64(e))
+		case int64:
+			dst = appendInt(dst, e)
+		case uint:
+			dst = appendUint(dst, uint64(e))
+		case uint8:
+			dst = appendUint(dst, uint64(e))
+		case uint16:
+			dst = appendUint(dst, uint64(e))
+		case uint32:
+			dst = appendUint(dst, uint64(e))
+		case uint64:
+			dst = appendUint(dst, e)
+		default:
+			panic(fmt.Sprintf("tuple: unsupported element type %T", e))
+		}
+	}
+	return dst
+}
+
+// appendEscaped appends b with every 0x00 escaped, followed by a 0x00
+// terminator.
+func appendEscaped(dst, b []byte) []byte {
+	for _, c := range b {
+		dst = append(dst, c)
+		if c == 0x00 {
+			dst = append(dst, escape)
+		}
+	}
+	return append(dst, 0x00)
+}
+
+// intSize returns the number of bytes needed to hold v.
+func intSize(v uint64) int {
+	n := 0
+	for v > 0 {
+		n++
+		v >>= 8
+	}
+	return n
+}
+
+// appendBigEndian appends the low n bytes of v in big-endian order.
+func appendBigEndian(dst []byte, v uint64, n int) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(dst, buf[8-n:]...)
+}
+
+func appendUint(dst []byte, v uint64) []byte {
+	n := intSize(v)
+	return appendBigEndian(append(dst, byte(intZero+n)), v, n)
+}
+
+func appendInt(dst []byte, v int64) []byte {
+	if v >= 0 {
+		return appendUint(dst, uint64(v))
+	}
+
+	// Negative values are stored as the one's complement of their
+	// magnitude, so that larger magnitudes sort first.
+	mag := uint64(^v) + 1
+	n := intSize(mag)
+	return appendBigEndian(append(dst, byte(intZero-n)), ^mag, n)
+}
+
+// Unpack decodes an encoded tuple. Integers are returned as int64, or as
+// uint64 if they are too large for an int64.
+func Unpack(b []byte) (T, error) {
+	t, rest, err := decode(b, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrInvalid
+	}
+	return t, nil
+}
+
+// decode decodes elements until the end of b or, for a nested tuple, until
+// its terminator, returning the rest of b after it.
+func decode(b []byte, nested bool) (T, []byte, error) {
+	t := T{}
+	for len(b) > 0 {
+		code := b[0]
+		b = b[1:]
+		switch {
+		case code == nilCode:
+			if !nested {
+				t = append(t, nil)
+				continue
+			}
+			if len(b) > 0 && b[0] == escape {
+				t = append(t, nil)
+				b = b[1:]
+				continue
+			}
+			return t, b, nil
+
+		case code == bytesCode || code == stringCode:
+			raw, rest, err := decodeEscaped(b)
+			if err != nil {
+				return nil, nil, err
+			}
+			b = rest
+			if code == bytesCode {
+				t = append(t, raw)
+			} else {
+				t = append(t, string(raw))
+			}
+
+		case code == nestedCode:
+			inner, rest, err := decode(b, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			b = rest
+			t = append(t, inner)
+
+		case code >= intZero-8 && code <= intZero+8:
+			v, rest, err := decodeInt(code, b)
+			if err != nil {
+				return nil, nil, err
+			}
+			b = rest
+			t = append(t, v)
+
+		default:
+			return nil, nil, ErrInvalid
+		}
+	}
+	if nested {
+		// The terminator is missing.
+		return nil, nil, ErrInvalid
+	}
+	return t, nil, nil
+}
+
+// decodeEscaped decodes escaped bytes up to their terminator, returning
+// the rest of b after it.
+func decodeEscaped(b []byte) ([]byte, []byte, error) {
+	out := []byte{}
+	for i := 0; i < len(b); i++ {
+		if b[i] != 0x00 {
+			out = append(out, b[i])
+			continue
+		}
+		if i+1 < len(b) && b[i+1] == escape {
+			out = append(out, 0x00)
+			i++
+			continue
+		}
+		return out, b[i+1:], nil
+	}
+	return nil, nil, ErrInvalid
+}
+
+func decodeInt(code byte, b []byte) (any, []byte, error) {
+	n := int(code) - intZero
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+	if len(b) < n {
+		return nil, nil, ErrInvalid
+	}
+	var buf [8]byte
+	copy(buf[8-n:], b[:n])
+	v := binary.BigEndian.Uint64(buf[:])
+	b = b[n:]
+
+	if !neg {
+		if v > math.MaxInt64 {
+			return v, b, nil
+		}
+		return int64(v), b, nil
+	}
+
+	mag := ^v
+	if n < 8 {
+		mag &= 1<<(8*n) - 1
+	}
+	if mag == 0 || mag > 1<<63 {
+		return nil, nil, ErrInvalid
+	}
+	return -int64(mag-1) - 1, b, nil
+}
@@ -0,0 +1,162 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package tuple
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	iradix "github.com/hashicorp/go-immutable-radix/v2"
+)
+
+func TestPack_RoundTrip(t *testing.T) {
+	cases := []T{
+		{},
+		{nil},
+		{"users", int64(42)},
+		{[]byte{0, 1, 0, 0xff}, "a\x00b"},
+		{int64(math.MinInt64), int64(-1), int64(0), int64(math.MaxInt64), uint64(math.MaxUint64)},
+		{"x", T{nil, "y", T{int64(1)}}, nil},
+	}
+	for _, c := range cases {
+		got, err := Unpack(c.Pack())
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !reflect.DeepEqual(got, c) {
+			t.Fatalf("bad: %v != %v", got, c)
+		}
+	}
+
+	// Narrower integer types decode as int64.
+	got, err := Unpack(T{int8(-5), uint16(7)}.Pack())
+	if err != nil || !reflect.DeepEqual(got, T{int64(-5), int64(7)}) {
+		t.Fatalf("bad: %v %v", got, err)
+	}
+}
+
+func TestPack_Order(t *testing.T) {
+	// Tuples in ascending order. Elements of different types sort by type
+	// code, so strings sort before nested tuples, which sort before
+	// integers.
+	tuples := []T{
+		{nil},
+		{[]byte("a")},
+		{"a"},
+		{"a", nil},
+		{"a", "b"},
+		{"a", int64(-300)},
+		{"a", int64(-1)},
+		{"a", int64(0)},
+		{"a", int64(1)},
+		{"a", int64(256)},
+		{"a\x00"},
+		{"ab"},
+		{T{"a"}},
+		{T{"a", "b"}},
+		{T{"b"}},
+		{int64(-1)},
+		{int64(0)},
+	}
+	for i := 1; i < len(tuples); i++ {
+		a, b := tuples[i-1].Pack(), tuples[i].Pack()
+		if bytes.Compare(a, b) >= 0 {
+			t.Fatalf("bad order: %v >= %v", tuples[i-1], tuples[i])
+		}
+	}
+}
+
+func TestUnpack_Invalid(t *testing.T) {
+	for _, b := range [][]byte{
+		{0x02, 'a'},
+		{0x05, 0x02, 'a', 0x00},
+		{0x16, 0x01},
+		{0x13, 0xff},
+		{0x40},
+	} {
+		if _, err := Unpack(b); err != ErrInvalid {
+			t.Fatalf("bad %x: %v", b, err)
+		}
+	}
+}
+
+func TestScanTuplePrefix(t *testing.T) {
+	txn := iradix.New[int]().Txn()
+	keys := []T{
+		{"users", int64(42), "email"},
+		{"users", int64(42), "name"},
+		{"users", int64(420), "name"},
+		{"users", int64(7), "name"},
+		{"users2", int64(42)},
+	}
+	for i, k := range keys {
+		txn.Insert(k.Pack(), i)
+	}
+	txn.Insert([]byte("not a tuple"), -1)
+	tree := txn.Commit()
+	root := tree.Root()
+
+	var got []string
+	iter := ScanTuplePrefix(root, T{"users", 42})
+	for k, _, ok := iter.Next(); ok; k, _, ok = iter.Next() {
+		got = append(got, k.String())
+	}
+	if iter.Err() != nil {
+		t.Fatalf("err: %v", iter.Err())
+	}
+	if !reflect.DeepEqual(got, []string{`("users", 42, "email")`, `("users", 42, "name")`}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	got = nil
+	err := WalkTuplePrefix(root, T{"users"}, func(k T, _ int) bool {
+		got = append(got, k.String())
+		return false
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{
+		`("users", 7, "name")`, `("users", 42, "email")`, `("users", 42, "name")`, `("users", 420, "name")`,
+	}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// Elements with an embedded zero byte start with the encoding of the
+	// same element cut at the zero byte, but are not under it.
+	txn = tree.Txn()
+	txn.Insert(T{"users\x00evil"}.Pack(), 10)
+	txn.Insert(T{"users", "\x00"}.Pack(), 11)
+	txn.Insert(T{T{"a", nil}}.Pack(), 12)
+	txn.Insert(T{T{"a"}, "b"}.Pack(), 13)
+	root = txn.Commit().Root()
+	for _, c := range []struct {
+		prefix T
+		want   []int
+	}{
+		{T{"users"}, []int{11, 3, 0, 1, 2}},
+		{T{"users\x00"}, nil},
+		{T{"users\x00evil"}, []int{10}},
+		{T{T{"a"}}, []int{13}},
+	} {
+		var vals []int
+		err := WalkTuplePrefix(root, c.prefix, func(_ T, v int) bool {
+			vals = append(vals, v)
+			return false
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !reflect.DeepEqual(vals, c.want) {
+			t.Fatalf("bad %v: %v", c.prefix, vals)
+		}
+	}
+
+	// A key that isn't a tuple stops the scan.
+	if err := WalkTuplePrefix(root, T{}, func(T, int) bool { return false }); err != ErrInvalid {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import "fmt"
+
+// TypedTree is an immutable tree keyed by values of type K, which are
+// stored encoded by a KeyCodec so that the tree's order matches the natural
+// order of K.
+type TypedTree[K, V any] struct {
+	tree  *Tree[V]
+	codec KeyCodec[K]
+}
+
+// NewTyped returns an empty TypedTree that encodes its keys with codec.
+func NewTyped[K, V any](codec KeyCodec[K]) *TypedTree[K, V] {
+	return &TypedTree[K, V]{tree: New[V](), codec: codec}
+}
+
+// Len is used to return the number of elements in the tree.
+func (t *TypedTree[K, V]) Len() int {
+	return t.tree.Len()
+}
+
+// Tree returns the underlying tree, whose keys are the encoded keys.
+func (t *TypedTree[K, V]) Tree() *Tree[V] {
+	return t.tree
+}
+
+// Get is used to lookup a specific key, returning the value and if it was
+// found.
+func (t *TypedTree[K, V]) Get(k K) (V, bool) {
+	return t.tree.Get(t.codec.AppendKey(nil, k))
+}
+
+// Insert is used to add or update a given key. The return provides the new
+// tree, previous value and a bool indicating if any was set.
+func (t *TypedTree[K, V]) Insert(k K, v V) (*TypedTree[K, V], V, bool) {
+	tree, old, ok := t.tree.Insert(t.codec.AppendKey(nil, k), v)
+	return &TypedTree[K, V]{tree: tree, codec: t.codec}, old, ok
+}
+
+// Delete is used to delete a given key. Returns the new tree, old value if
+// any, and a bool indicating if the key was set.
+func (t *TypedTree[K, V]) Delete(k K) (*TypedTree[K, V], V, bool) {
+	tree, old, ok := t.tree.Delete(t.codec.AppendKey(nil, k))
+	return &TypedTree[K, V]{tree: tree, codec: t.codec}, old, ok
+}
+
+// LongestPrefix is like Get, but instead of an exact match, it will return
+// the longest key whose encoding is a prefix of the encoding of k.
+func (t *TypedTree[K, V]) LongestPrefix(k K) (K, V, bool) {
+	ek, v, ok := t.tree.Root().LongestPrefix(t.codec.AppendKey(nil, k))
+	if !ok {
+		var zero K
+		return zero, v, false
+	}
+	return t.decode(ek), v, true
+}
+
+// Minimum is used to return the minimum value in the tree.
+func (t *TypedTree[K, V]) Minimum() (K, V, bool) {
+	ek, v, ok := t.tree.Root().Minimum()
+	if !ok {
+		var zero K
+		return zero, v, false
+	}
+	return t.decode(ek), v, true
+}
+
+// Maximum is used to return the maximum value in the tree.
+func (t *TypedTree[K, V]) Maximum() (K, V, bool) {
+	ek, v, ok := t.tree.Root().Maximum()
+	if !ok {
+		var zero K
+		return zero, v, false
+	}
+	return t.decode(ek), v, true
+}
+
+// Walk is used to walk the tree in key order.
+func (t *TypedTree[K, V]) Walk(fn func(k K, v V) bool) {
+	t.tree.Root().Walk(func(ek []byte, v V) bool {
+		return fn(t.decode(ek), v)
+	})
+}
+
+// WalkBackwards is used to walk the tree in reverse key order.
+func (t *TypedTree[K, V]) WalkBackwards(fn func(k K, v V) bool) {
+	t.tree.Root().WalkBackwards(func(ek []byte, v V) bool {
+		return fn(t.decode(ek), v)
+	})
+}
+
+// decode decodes a key read from the tree. Every key in the tree was
+// encoded by the codec, so failing to decode one means the codec is broken.
+func (t *TypedTree[K, V]) decode(ek []byte) K {
+	return decodeTypedKey(t.codec, ek)
+}
+
+func decodeTypedKey[K any](codec KeyCodec[K], ek []byte) K {
+	k, err := codec.DecodeKey(ek)
+	if err != nil {
+		panic(fmt.Sprintf("iradix: failed to decode key %x: %v", ek, err))
+	}
+	return k
+}
+
+// TypedIterator is used to iterate over the entries of a TypedTree in key
+// order.
+type TypedIterator[K, V any] struct {
+	iter  *Iterator[V]
+	codec KeyCodec[K]
+}
+
+// Iterator returns an iterator over the tree.
+func (t *TypedTree[K, V]) Iterator() *TypedIterator[K, V] {
+	return &TypedIterator[K, V]{iter: t.tree.Root().Iterator(), codec: t.codec}
+}
+
+// SeekLowerBound is used to seek the iterator to the smallest key that is
+// greater or equal to the given key.
+func (i *TypedIterator[K, V]) SeekLowerBound(k K) {
+	i.iter.SeekLowerBound(i.codec.AppendKey(nil, k))
+}
+
+// Next returns the next entry in order.
+func (i *TypedIterator[K, V]) Next() (K, V, bool) {
+	ek, v, ok := i.iter.Next()
+	if !ok {
+		var zero K
+		return zero, v, false
+	}
+	return decodeTypedKey(i.codec, ek), v, true
+}
+
+// TypedReverseIterator is used to iterate over the entries of a TypedTree
+// in reverse key order.
+type TypedReverseIterator[K, V any] struct {
+	iter  *ReverseIterator[V]
+	codec KeyCodec[K]
+}
+
+// ReverseIterator returns a reverse iterator over the tree.
+func (t *TypedTree[K, V]) ReverseIterator() *TypedReverseIterator[K, V] {
+	return &TypedReverseIterator[K, V]{iter: t.tree.Root().ReverseIterator(), codec: t.codec}
+}
+
+// SeekReverseLowerBound is used to seek the iterator to the largest key
+// that is lower or equal to the given key.
+func (ri *TypedReverseIterator[K, V]) SeekReverseLowerBound(k K) {
+	ri.iter.SeekReverseLowerBound(ri.codec.AppendKey(nil, k))
+}
+
+// Previous returns the previous entry in reverse order.
+func (ri *TypedReverseIterator[K, V]) Previous() (K, V, bool) {
+	ek, v, ok := ri.iter.Previous()
+	if !ok {
+		var zero K
+		return zero, v, false
+	}
+	return decodeTypedKey(ri.codec, ek), v, true
+}
+
+// TypedTxn is a transaction on a TypedTree. Like Txn it is not thread safe.
+type TypedTxn[K, V any] struct {
+	txn   *Txn[V]
+	codec KeyCodec[K]
+}
+
+// Txn starts a new transaction that can be used to mutate the tree.
+func (t *TypedTree[K, V]) Txn() *TypedTxn[K, V] {
+	return &TypedTxn[K, V]{txn: t.tree.Txn(), codec: t.codec}
+}
+
+// TrackMutate can be used to toggle if mutations are tracked, see
+// Txn.TrackMutate.
+func (t *TypedTxn[K, V]) TrackMutate(track bool) {
+	t.txn.TrackMutate(track)
+}
+
+// Get is used to lookup a specific key, returning the value and if it was
+// found.
+func (t *TypedTxn[K, V]) Get(k K) (V, bool) {
+	return t.txn.Get(t.codec.AppendKey(nil, k))
+}
+
+// GetWatch is used to lookup a specific key, returning the watch channel,
+// value and if it was found.
+func (t *TypedTxn[K, V]) GetWatch(k K) (<-chan struct{}, V, bool) {
+	return t.txn.GetWatch(t.codec.AppendKey(nil, k))
+}
+
+// Insert is used to add or update a given key. The return provides the
+// previous value and a bool indicating if any was set.
+func (t *TypedTxn[K, V]) Insert(k K, v V) (V, bool) {
+	return t.txn.Insert(t.codec.AppendKey(nil, k), v)
+}
+
+// Delete is used to delete a given key. Returns the old value if any, and a
+// bool indicating if the key was set.
+func (t *TypedTxn[K, V]) Delete(k K) (V, bool) {
+	return t.txn.Delete(t.codec.AppendKey(nil, k))
+}
+
+// Commit is used to finalize the transaction and return a new tree. If
+// mutation tracking is turned on then notifications will also be issued.
+func (t *TypedTxn[K, V]) Commit() *TypedTree[K, V] {
+	return &TypedTree[K, V]{tree: t.txn.Commit(), codec: t.codec}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTypedTree(t *testing.T) {
+	r := NewTyped[int, string](IntKeyCodec[int]{})
+	txn := r.Txn()
+	for _, k := range []int{5, -3, 100, 0, -200} {
+		txn.Insert(k, "v")
+	}
+	r = txn.Commit()
+
+	var keys []int
+	r.Walk(func(k int, _ string) bool {
+		keys = append(keys, k)
+		return false
+	})
+	if !reflect.DeepEqual(keys, []int{-200, -3, 0, 5, 100}) {
+		t.Fatalf("bad: %v", keys)
+	}
+	if k, _, _ := r.Minimum(); k != -200 {
+		t.Fatalf("bad: %v", k)
+	}
+	if k, _, _ := r.Maximum(); k != 100 {
+		t.Fatalf("bad: %v", k)
+	}
+
+	iter := r.Iterator()
+	iter.SeekLowerBound(-4)
+	if k, _, ok := iter.Next(); !ok || k != -3 {
+		t.Fatalf("bad: %v", k)
+	}
+	riter := r.ReverseIterator()
+	riter.SeekReverseLowerBound(4)
+	if k, _, ok := riter.Previous(); !ok || k != 0 {
+		t.Fatalf("bad: %v", k)
+	}
+
+	r, old, ok := r.Delete(5)
+	if !ok || old != "v" || r.Len() != 4 {
+		t.Fatalf("bad: %v %v %d", old, ok, r.Len())
+	}
+	if _, ok := r.Get(5); ok {
+		t.Fatalf("should be deleted")
+	}
+}
+
+func TestTypedTree_LongestPrefix(t *testing.T) {
+	r := NewTyped[string, int](StringKeyCodec{})
+	r, _, _ = r.Insert("foo", 1)
+	r, _, _ = r.Insert("foo/bar", 2)
+	if k, v, ok := r.LongestPrefix("foo/baz"); !ok || k != "foo" || v != 1 {
+		t.Fatalf("bad: %v %v", k, v)
+	}
+	if _, _, ok := r.LongestPrefix("fo"); ok {
+		t.Fatalf("should not match")
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RetentionPolicy controls which old versions a Versioned store keeps. The
+// latest version is always kept. A zero value for either limit disables it.
+type RetentionPolicy struct {
+	// MaxVersions is the maximum number of versions to keep, including the
+	// latest one.
+	MaxVersions int
+
+	// MaxAge is how long a version is kept after it was committed.
+	MaxAge time.Duration
+
+	// Now returns the current time. It defaults to time.Now and can be
+	// replaced to make age based retention deterministic in tests.
+	Now func() time.Time
+}
+
+// version is a single committed tree along with the keys that changed in it
+// compared to the previous version.
+type version[T any] struct {
+	tree      *Tree[T]
+	committed time.Time
+	changed   [][]byte
+}
+
+// Versioned keeps a history of committed trees, each identified by a
+// version number that increases by one with every commit. Structural
+// sharing between the trees means each version costs roughly the size of
+// its change. It also indexes, for every key, the versions in which that key
+// was changed, so History doesn't have to look at every version.
+//
+// Versioned is safe for concurrent use. The trees it returns are immutable
+// and may be read without any coordination.
+type Versioned[T any] struct {
+	l sync.RWMutex
+
+	// first is the version number of versions[0].
+	first    uint64
+	versions []version[T]
+
+	// history maps the escaped key followed by the big-endian version
+	// number to nothing, so a prefix scan on the escaped key lists the
+	// versions that changed it in order.
+	history *Tree[struct{}]
+
+	policy RetentionPolicy
+}
+
+// NewVersioned returns a Versioned store whose version 0 is base. Keys
+// present in base are not part of any key's history.
+func NewVersioned[T any](base *Tree[T], policy RetentionPolicy) *Versioned[T] {
+	if policy.Now == nil {
+		policy.Now = time.Now
+	}
+	return &Versioned[T]{
+		versions: []version[T]{{tree: base, committed: policy.Now()}},
+		history:  New[struct{}](),
+		policy:   policy,
+	}
+}
+
+// Latest returns the newest tree along with its version number.
+func (v *Versioned[T]) Latest() (*Tree[T], uint64) {
+	v.l.RLock()
+	defer v.l.RUnlock()
+	last := len(v.versions) - 1
+	return v.versions[last].tree, v.first + uint64(last)
+}
+
+// At returns the tree as of the given version, or nil if that version has
+// been dropped by the retention policy or hasn't been committed yet.
+func (v *Versioned[T]) At(ver uint64) *Tree[T] {
+	v.l.RLock()
+	defer v.l.RUnlock()
+	if ver < v.first || ver-v.first >= uint64(len(v.versions)) {
+		return nil
+	}
+	return v.versions[ver-v.first].tree
+}
+
+// Txn starts a new transaction on top of the latest version.
+func (v *Versioned[T]) Txn() *Txn[T] {
+	t, _ := v.Latest()
+	return t.Txn()
+}
+
+// Commit commits the transaction and records the resulting tree as a new
+// version, returning its version number. Commits are serialized. If the
+// transaction was not started from the latest version, an error wrapping
+// ErrCommitConflict is returned and nothing is committed, so commits made in
+// between are never lost. Any mutation notifications are issued before
+// Commit returns.
+func (v *Versioned[T]) Commit(txn *Txn[T]) (uint64, error) {
+	v.l.Lock()
+	defer v.l.Unlock()
+
+	prev := v.versions[len(v.versions)-1].tree
+	if txn.snap != prev.root {
+		return 0, fmt.Errorf("%w: transaction is not based on version %d",
+			ErrCommitConflict, v.first+uint64(len(v.versions))-1)
+	}
+	t := txn.Commit()
+	ver := v.first + uint64(len(v.versions))
+
+	var changed [][]byte
+	htxn := v.history.Txn()
+	diffNodes(prev.root, t.root, func(k []byte, _, _ *leafNode[T]) bool {
+		changed = append(changed, k)
+		htxn.Insert(historyKey(k, ver), struct{}{})
+		return false
+	})
+	v.history = htxn.Commit()
+
+	v.versions = append(v.versions, version[T]{
+		tree:      t,
+		committed: v.policy.Now(),
+		changed:   changed,
+	})
+	v.prune()
+	return ver, nil
+}
+
+// History returns the retained versions in which the given key was
+// inserted, updated or deleted, in increasing order.
+func (v *Versioned[T]) History(k []byte) []uint64 {
+	v.l.RLock()
+	defer v.l.RUnlock()
+
+	prefix := escapeKey(k)
+	var out []uint64
+	v.history.Root().WalkPrefix(prefix, func(hk []byte, _ struct{}) bool {
+		out = append(out, binary.BigEndian.Uint64(hk[len(prefix):]))
+		return false
+	})
+	return out
+}
+
+// Prune drops the versions that fall outside of the retention policy. This
+// happens on every Commit, so it only needs to be called to enforce the
+// maximum age when there haven't been any recent commits.
+func (v *Versioned[T]) Prune() {
+	v.l.Lock()
+	defer v.l.Unlock()
+	v.prune()
+}
+
+// prune does the work for Prune and must be called with the lock held.
+func (v *Versioned[T]) prune() {
+	drop := 0
+	if limit := v.policy.MaxVersions; limit > 0 && len(v.versions) > limit {
+		drop = len(v.versions) - limit
+	}
+	if v.policy.MaxAge > 0 {
+		cutoff := v.policy.Now().Add(-v.policy.MaxAge)
+		for drop < len(v.versions)-1 && v.versions[drop].committed.Before(cutoff) {
+			drop++
+		}
+	}
+	if drop == 0 {
+		return
+	}
+
+	htxn := v.history.Txn()
+	for idx, dropped := range v.versions[:drop] {
+		for _, k := range dropped.changed {
+			htxn.Delete(historyKey(k, v.first+uint64(idx)))
+		}
+	}
+	v.history = htxn.Commit()
+
+	// Copy the survivors so the dropped trees can be garbage collected.
+	v.versions = append([]version[T](nil), v.versions[drop:]...)
+	v.first += uint64(drop)
+}
+
+// historyKey returns the history index key for a change to k in the given
+// version.
+func historyKey(k []byte, ver uint64) []byte {
+	out := escapeKey(k)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], ver)
+	return append(out, buf[:]...)
+}
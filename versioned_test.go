@@ -0,0 +1,159 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVersioned(t *testing.T) {
+	base, _, _ := New[string]().Insert([]byte("foo"), "0")
+	v := NewVersioned(base, RetentionPolicy{})
+
+	txn := v.Txn()
+	txn.Insert([]byte("foo"), "1")
+	txn.Insert([]byte("foobar"), "1")
+	if ver, err := v.Commit(txn); err != nil || ver != 1 {
+		t.Fatalf("bad version: %d %v", ver, err)
+	}
+
+	txn = v.Txn()
+	txn.Insert([]byte("zip"), "2")
+	mustCommitVersion(t, v, txn)
+
+	txn = v.Txn()
+	txn.Delete([]byte("foobar"))
+	txn.Insert([]byte("foo\x00"), "3")
+	mustCommitVersion(t, v, txn)
+
+	latest, ver := v.Latest()
+	if ver != 3 || latest.Len() != 3 {
+		t.Fatalf("bad: %d %d", ver, latest.Len())
+	}
+	if out, _ := v.At(0).Get([]byte("foo")); out != "0" {
+		t.Fatalf("bad: %v", out)
+	}
+	if _, ok := v.At(2).Get([]byte("foobar")); !ok {
+		t.Fatalf("missing foobar at version 2")
+	}
+	if _, ok := v.At(3).Get([]byte("foobar")); ok {
+		t.Fatalf("foobar should be gone at version 3")
+	}
+	if v.At(4) != nil {
+		t.Fatalf("version 4 should not exist")
+	}
+
+	cases := map[string][]uint64{
+		"foo":     {1},
+		"foobar":  {1, 3},
+		"zip":     {2},
+		"foo\x00": {3},
+		"fo":      nil,
+	}
+	for k, want := range cases {
+		if got := v.History([]byte(k)); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%q: got %v, want %v", k, got, want)
+		}
+	}
+}
+
+func mustCommitVersion[T any](t *testing.T, v *Versioned[T], txn *Txn[T]) uint64 {
+	t.Helper()
+	ver, err := v.Commit(txn)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return ver
+}
+
+func TestVersioned_StaleTxn(t *testing.T) {
+	v := NewVersioned(New[string](), RetentionPolicy{})
+
+	stale := v.Txn()
+	stale.Insert([]byte("bar"), "stale")
+
+	txn := v.Txn()
+	txn.Insert([]byte("foo"), "1")
+	mustCommitVersion(t, v, txn)
+
+	if _, err := v.Commit(stale); !errors.Is(err, ErrCommitConflict) {
+		t.Fatalf("bad: %v", err)
+	}
+	latest, ver := v.Latest()
+	if ver != 1 || latest.Len() != 1 {
+		t.Fatalf("bad: %d %d", ver, latest.Len())
+	}
+	if _, ok := latest.Get([]byte("foo")); !ok {
+		t.Fatalf("missing foo")
+	}
+	if got := v.History([]byte("bar")); got != nil {
+		t.Fatalf("bad: %v", got)
+	}
+
+	// A transaction started from the latest version still commits.
+	txn = v.Txn()
+	txn.Insert([]byte("bar"), "2")
+	if ver := mustCommitVersion(t, v, txn); ver != 2 {
+		t.Fatalf("bad version: %d", ver)
+	}
+}
+
+func TestVersioned_SharedSubtrees(t *testing.T) {
+	r := New[string]()
+	txn := r.Txn()
+	for i := 0; i < 1000; i++ {
+		k := []byte{byte(i >> 8), byte(i)}
+		txn.Insert(k, "v")
+	}
+	v := NewVersioned(txn.Commit(), RetentionPolicy{})
+
+	txn = v.Txn()
+	txn.Insert([]byte{1, 1}, "changed")
+	ver := mustCommitVersion(t, v, txn)
+	if got := v.History([]byte{1, 1}); !reflect.DeepEqual(got, []uint64{ver}) {
+		t.Fatalf("bad: %v", got)
+	}
+	if got := v.History([]byte{1, 2}); got != nil {
+		t.Fatalf("bad: %v", got)
+	}
+}
+
+func TestVersioned_Retention(t *testing.T) {
+	now := time.Unix(1000, 0)
+	clock := func() time.Time { return now }
+
+	v := NewVersioned(New[string](), RetentionPolicy{MaxVersions: 3, Now: clock})
+	for i := 0; i < 5; i++ {
+		txn := v.Txn()
+		txn.Insert([]byte("foo"), "v")
+		mustCommitVersion(t, v, txn)
+	}
+	if v.At(2) != nil || v.At(3) == nil || v.At(5) == nil {
+		t.Fatalf("bad retention")
+	}
+	if got := v.History([]byte("foo")); !reflect.DeepEqual(got, []uint64{3, 4, 5}) {
+		t.Fatalf("bad: %v", got)
+	}
+
+	v = NewVersioned(New[string](), RetentionPolicy{MaxAge: time.Minute, Now: clock})
+	for i := 0; i < 3; i++ {
+		txn := v.Txn()
+		txn.Insert([]byte("foo"), "v")
+		mustCommitVersion(t, v, txn)
+		now = now.Add(time.Minute)
+	}
+	v.Prune()
+	if v.At(2) != nil {
+		t.Fatalf("version 2 should have expired")
+	}
+	if latest, ver := v.Latest(); latest == nil || ver != 3 || v.At(3) == nil {
+		t.Fatalf("latest version should never expire")
+	}
+	if got := v.History([]byte("foo")); !reflect.DeepEqual(got, []uint64{3}) {
+		t.Fatalf("bad: %v", got)
+	}
+}
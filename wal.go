@@ -0,0 +1,306 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Log record types. A transaction's records are buffered until it is
+// committed, and then written as a batch. Each record is the record type,
+// the uvarint key length and the key, then for walInsert the uvarint length
+// of the encoded value and the value.
+const (
+	walInsert byte = iota + 1
+	walDelete
+	walDeletePrefix
+)
+
+// A batch is written as one or more frames. Every frame is a 4 byte
+// little-endian payload length, the CRC-32C of the payload, and the CRC-32C
+// of those first 8 bytes, followed by the payload. The payload is a flags
+// byte followed by the next part of the batch. The header has a checksum of
+// its own so that a damaged length can't be mistaken for a frame that was
+// cut short by a crash.
+const (
+	// walFirst marks the first frame of a batch, and walLast the last one.
+	// Only a batch whose last frame was written is committed.
+	walFirst byte = 1 << iota
+	walLast
+)
+
+// walHeaderSize is the size of the length and checksums preceding each
+// frame.
+const walHeaderSize = 12
+
+// maxWALFrameSize is the largest payload of a single frame. Larger batches
+// are split across frames, and longer lengths are treated as corruption.
+const maxWALFrameSize = 16 << 20
+
+// ErrLogCorrupt is returned by Replay when a frame in the middle of the
+// log fails its checksum or can't be parsed.
+var ErrLogCorrupt = errors.New("iradix: corrupt log record")
+
+var walTable = crc32.MakeTable(crc32.Castagnoli)
+
+// txnLog is the write-ahead log state attached to a transaction.
+type txnLog[T any] struct {
+	w     io.Writer
+	codec Codec[T]
+
+	// batch holds the records of the operations since the transaction was
+	// last committed.
+	batch []byte
+
+	// err is the first error hit while encoding or writing. Once set, no
+	// more records are written.
+	err error
+}
+
+// write adds a single record to the batch.
+func (l *txnLog[T]) write(op byte, k []byte, v []byte) {
+	if l.err != nil {
+		return
+	}
+	var lenBuf [binary.MaxVarintLen64]byte
+	l.batch = append(l.batch, op)
+	l.batch = append(l.batch, lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(k)))]...)
+	l.batch = append(l.batch, k...)
+	if op == walInsert {
+		l.batch = append(l.batch, lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(v)))]...)
+		l.batch = append(l.batch, v...)
+	}
+}
+
+func (l *txnLog[T]) insert(k []byte, v T) {
+	if l.err != nil {
+		return
+	}
+	b, err := l.codec.Encode(v)
+	if err != nil {
+		l.err = err
+		return
+	}
+	l.write(walInsert, k, b)
+}
+
+// commit writes out the batch, if there is one, and starts a new one.
+func (l *txnLog[T]) commit() {
+	batch := l.batch
+	l.batch = l.batch[:0]
+	if l.err != nil || len(batch) == 0 {
+		return
+	}
+
+	flags := walFirst
+	for {
+		part := batch
+		if len(part) > maxWALFrameSize-1 {
+			part = part[:maxWALFrameSize-1]
+		}
+		batch = batch[len(part):]
+		if len(batch) == 0 {
+			flags |= walLast
+		}
+
+		// Build the whole frame up front so it goes out in a single write,
+		// which makes torn frames less likely.
+		frame := make([]byte, walHeaderSize, walHeaderSize+1+len(part))
+		frame = append(frame, flags)
+		frame = append(frame, part...)
+		payload := frame[walHeaderSize:]
+		binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+		binary.LittleEndian.PutUint32(frame[4:8], crc32.Checksum(payload, walTable))
+		binary.LittleEndian.PutUint32(frame[8:12], crc32.Checksum(frame[0:8], walTable))
+		if _, l.err = l.w.Write(frame); l.err != nil || len(batch) == 0 {
+			return
+		}
+		flags = 0
+	}
+}
+
+// SetLog makes the transaction record every Insert, Delete and
+// DeletePrefix that changes the tree, and write the records to w as a
+// single batch each time it is committed. Values are encoded with codec.
+// Nothing is written for a transaction that is never committed, so the
+// records are held in memory until then. Passing a nil writer turns
+// logging off. Clones of the transaction do not inherit the log.
+//
+// Errors don't interrupt the transaction. Once one happens logging stops,
+// and the error is reported by LogErr, which should be checked after
+// committing before relying on the log.
+func (t *Txn[T]) SetLog(w io.Writer, codec Codec[T]) {
+	if w == nil {
+		t.log = nil
+		return
+	}
+	t.log = &txnLog[T]{w: w, codec: codec}
+}
+
+// LogErr returns the first error encountered while writing to the log set
+// by SetLog, if any.
+func (t *Txn[T]) LogErr() error {
+	if t.log == nil {
+		return nil
+	}
+	return t.log.err
+}
+
+// walOp is a decoded log record.
+type walOp struct {
+	op  byte
+	key []byte
+	val []byte
+}
+
+// Replay reads a log written through Txn.SetLog and applies every committed
+// transaction in it to base, returning the resulting tree. A final batch
+// that was only partly written is discarded, as is a batch whose later
+// frames were never written because writing them failed. A damaged frame anywhere else is
+// reported as ErrLogCorrupt, along with the tree as of the last good batch.
+func Replay[T any](r io.Reader, base *Tree[T], codec Codec[T]) (*Tree[T], error) {
+	br := bufio.NewReader(r)
+	txn := base.Txn()
+
+	// The parts of a batch are held back until its last frame is seen, so
+	// the transaction only ever holds fully committed state.
+	var pending []byte
+	var inBatch bool
+	var offset int64
+	for {
+		payload, err := readWALFrame(br)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return txn.Commit(), fmt.Errorf("%w at offset %d", err, offset)
+		}
+		flags := payload[0]
+		if flags&^(walFirst|walLast) != 0 || (flags&walFirst == 0 && !inBatch) {
+			return txn.Commit(), fmt.Errorf("%w at offset %d", ErrLogCorrupt, offset)
+		}
+		offset += int64(walHeaderSize + len(payload))
+
+		// A new batch replaces one that was never finished.
+		if flags&walFirst != 0 {
+			pending = nil
+		}
+		pending = append(pending, payload[1:]...)
+		inBatch = flags&walLast == 0
+		if inBatch {
+			continue
+		}
+
+		// Decode every record before applying anything so a bad record
+		// can't leave half a transaction behind.
+		ops, err := parseWALBatch(pending)
+		if err != nil {
+			return txn.Commit(), fmt.Errorf("%w in batch ending at offset %d", err, offset)
+		}
+		vals := make([]T, len(ops))
+		for idx, op := range ops {
+			if op.op != walInsert {
+				continue
+			}
+			if vals[idx], err = codec.Decode(op.val); err != nil {
+				return txn.Commit(), err
+			}
+		}
+		for idx, op := range ops {
+			switch op.op {
+			case walInsert:
+				txn.Insert(op.key, vals[idx])
+			case walDelete:
+				txn.Delete(op.key)
+			case walDeletePrefix:
+				txn.DeletePrefix(op.key)
+			}
+		}
+
+		// The tree now holds on to the keys, so the next batch gets a
+		// buffer of its own.
+		pending = nil
+	}
+	return txn.Commit(), nil
+}
+
+// readWALFrame reads a single frame and verifies its checksums, returning
+// its payload. A frame cut short by the end of the log, or a damaged frame
+// that is the last thing in the log, is reported as io.ErrUnexpectedEOF.
+func readWALFrame(br *bufio.Reader) ([]byte, error) {
+	var header [walHeaderSize]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(header[0:8], walTable) != binary.LittleEndian.Uint32(header[8:12]) {
+		return nil, walDamaged(br)
+	}
+	size := binary.LittleEndian.Uint32(header[0:4])
+	if size == 0 || size > maxWALFrameSize {
+		return nil, ErrLogCorrupt
+	}
+
+	// The header is intact, so a short read means the log really ends in
+	// the middle of this frame.
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if crc32.Checksum(payload, walTable) != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, walDamaged(br)
+	}
+	return payload, nil
+}
+
+// walDamaged returns the error for a frame that failed a checksum, which is
+// treated as torn if nothing follows it.
+func walDamaged(br *bufio.Reader) error {
+	if _, err := br.Peek(1); err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return ErrLogCorrupt
+}
+
+// parseWALBatch decodes the records of a batch.
+func parseWALBatch(b []byte) ([]walOp, error) {
+	var ops []walOp
+	for len(b) > 0 {
+		op := walOp{op: b[0]}
+		switch op.op {
+		case walInsert, walDelete, walDeletePrefix:
+		default:
+			return nil, ErrLogCorrupt
+		}
+		var ok bool
+		if op.key, b, ok = walBytes(b[1:]); !ok {
+			return nil, ErrLogCorrupt
+		}
+		if op.op == walInsert {
+			if op.val, b, ok = walBytes(b); !ok {
+				return nil, ErrLogCorrupt
+			}
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// walBytes decodes a uvarint length and that many bytes from the front of
+// b, returning them and the rest of b.
+func walBytes(b []byte) ([]byte, []byte, bool) {
+	n, size := binary.Uvarint(b)
+	if size <= 0 || uint64(len(b)-size) < n {
+		return nil, nil, false
+	}
+	b = b[size:]
+	return b[:n:n], b[n:], true
+}
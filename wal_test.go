@@ -0,0 +1,263 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// errWriter fails every write after the first n bytes.
+type errWriter struct {
+	n int
+}
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, errors.New("disk full")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestReplay(t *testing.T) {
+	var log bytes.Buffer
+	r := New[string]()
+
+	txn := r.Txn()
+	txn.SetLog(&log, stringCodec{})
+	txn.Insert([]byte("foo"), "1")
+	txn.Insert([]byte("foo/bar"), "2")
+	txn.Insert([]byte("foo/baz"), "3")
+	txn.Insert([]byte("zip"), "4")
+	r = txn.Commit()
+
+	txn = r.Txn()
+	txn.SetLog(&log, stringCodec{})
+	txn.Delete([]byte("zip"))
+	txn.Delete([]byte("missing"))
+	txn.DeletePrefix([]byte("foo/"))
+	txn.Insert([]byte("foo"), "5")
+	r = txn.Commit()
+	if err := txn.LogErr(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	out, err := Replay[string](bytes.NewReader(log.Bytes()), New[string](), stringCodec{})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.Len() != r.Len() || !reflect.DeepEqual(treeContents(out), treeContents(r)) {
+		t.Fatalf("bad: %v", treeContents(out))
+	}
+}
+
+func TestReplay_TornTxn(t *testing.T) {
+	var log bytes.Buffer
+	txn := New[string]().Txn()
+	txn.SetLog(&log, stringCodec{})
+	txn.Insert([]byte("foo"), "1")
+	committed := txn.Commit()
+	committedLen := log.Len()
+
+	txn.Insert([]byte("bar"), "2")
+	txn.Delete([]byte("foo"))
+	txn.Commit()
+	full := log.Bytes()
+
+	// Every truncation inside the second transaction, including the middle
+	// of its commit record, should recover the first transaction only.
+	for n := committedLen; n < len(full); n++ {
+		out, err := Replay[string](bytes.NewReader(full[:n]), New[string](), stringCodec{})
+		if err != nil {
+			t.Fatalf("%d: err: %v", n, err)
+		}
+		if !reflect.DeepEqual(treeContents(out), treeContents(committed)) {
+			t.Fatalf("%d: bad: %v", n, treeContents(out))
+		}
+	}
+
+	// A garbled final record is treated the same as a torn one.
+	garbled := append([]byte{}, full...)
+	garbled[len(garbled)-1] ^= 0xff
+	out, err := Replay[string](bytes.NewReader(garbled), New[string](), stringCodec{})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(treeContents(out), treeContents(committed)) {
+		t.Fatalf("bad: %v", treeContents(out))
+	}
+}
+
+func TestReplay_Corrupt(t *testing.T) {
+	var log bytes.Buffer
+	txn := New[string]().Txn()
+	txn.SetLog(&log, stringCodec{})
+	txn.Insert([]byte("foo"), "1")
+	committed := txn.Commit()
+	txn.Insert([]byte("bar"), "2")
+	txn.Commit()
+	txn.Insert([]byte("baz"), "3")
+	txn.Commit()
+
+	// Flip a byte in the payload of the second batch, which is followed by
+	// the third.
+	corrupt := append([]byte{}, log.Bytes()...)
+	idx := bytes.Index(corrupt, []byte("bar"))
+	corrupt[idx] ^= 0xff
+
+	out, err := Replay[string](bytes.NewReader(corrupt), New[string](), stringCodec{})
+	if !errors.Is(err, ErrLogCorrupt) {
+		t.Fatalf("expected corruption, got: %v", err)
+	}
+	if !reflect.DeepEqual(treeContents(out), treeContents(committed)) {
+		t.Fatalf("bad: %v", treeContents(out))
+	}
+}
+
+func TestReplay_CorruptLength(t *testing.T) {
+	var log bytes.Buffer
+	txn := New[string]().Txn()
+	txn.SetLog(&log, stringCodec{})
+	txn.Insert([]byte("foo"), "1")
+	committed := txn.Commit()
+	second := log.Len()
+	for _, k := range []string{"bar", "baz", "zip"} {
+		txn.Insert([]byte(k), k)
+		txn.Commit()
+	}
+
+	// A length in the middle of the log that is too long, either to be
+	// plausible or for the rest of the log, must not pass for a torn
+	// frame at the end.
+	for i, size := range []uint32{1 << 31, uint32(log.Len()), 1 << 31} {
+		corrupt := append([]byte{}, log.Bytes()...)
+		binary.LittleEndian.PutUint32(corrupt[second:], size)
+		if i == 2 {
+			// The header checksum matches, so only the limit on frame
+			// sizes catches it.
+			binary.LittleEndian.PutUint32(corrupt[second+8:], crc32.Checksum(corrupt[second:second+8], walTable))
+		}
+		out, err := Replay[string](bytes.NewReader(corrupt), New[string](), stringCodec{})
+		if !errors.Is(err, ErrLogCorrupt) {
+			t.Fatalf("expected corruption, got: %v", err)
+		}
+		if !reflect.DeepEqual(treeContents(out), treeContents(committed)) {
+			t.Fatalf("bad: %v", treeContents(out))
+		}
+	}
+}
+
+func TestReplay_AbandonedTxn(t *testing.T) {
+	var log bytes.Buffer
+	r := New[string]()
+
+	// Nothing from a transaction that is never committed reaches the log,
+	// even if another transaction commits to the same writer afterwards.
+	abandoned := r.Txn()
+	abandoned.SetLog(&log, stringCodec{})
+	abandoned.Insert([]byte("foo"), "1")
+	abandoned.DeletePrefix([]byte(""))
+	if log.Len() != 0 {
+		t.Fatalf("bad: %d bytes logged before commit", log.Len())
+	}
+
+	txn := r.Txn()
+	txn.SetLog(&log, stringCodec{})
+	txn.Insert([]byte("bar"), "2")
+	r = txn.Commit()
+
+	out, err := Replay[string](bytes.NewReader(log.Bytes()), New[string](), stringCodec{})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.Len() != 1 || !reflect.DeepEqual(treeContents(out), treeContents(r)) {
+		t.Fatalf("bad: %v", treeContents(out))
+	}
+}
+
+// frameWriter fails every write after the first n.
+type frameWriter struct {
+	w io.Writer
+	n int
+}
+
+func (w *frameWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("disk full")
+	}
+	w.n--
+	return w.w.Write(p)
+}
+
+func TestReplay_LargeBatch(t *testing.T) {
+	big := strings.Repeat("x", maxWALFrameSize/2+1)
+	var log bytes.Buffer
+	txn := New[string]().Txn()
+	txn.SetLog(&log, stringCodec{})
+	for _, k := range []string{"a", "b", "c"} {
+		txn.Insert([]byte(k), big)
+	}
+	r := txn.Commit()
+	if err := txn.LogErr(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	out, err := Replay[string](bytes.NewReader(log.Bytes()), New[string](), stringCodec{})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(treeContents(out), treeContents(r)) {
+		t.Fatalf("bad: replayed tree differs")
+	}
+
+	// A batch whose first frame made it out but whose second didn't is
+	// dropped, and the next batch is still replayed.
+	log.Reset()
+	txn = New[string]().Txn()
+	txn.SetLog(&frameWriter{w: &log, n: 1}, stringCodec{})
+	for _, k := range []string{"a", "b", "c"} {
+		txn.Insert([]byte(k), big)
+	}
+	txn.Commit()
+	if err := txn.LogErr(); err == nil {
+		t.Fatalf("expected error")
+	}
+	txn = New[string]().Txn()
+	txn.SetLog(&log, stringCodec{})
+	txn.Insert([]byte("d"), "1")
+	r = txn.Commit()
+	out, err = Replay[string](bytes.NewReader(log.Bytes()), New[string](), stringCodec{})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(treeContents(out), treeContents(r)) {
+		t.Fatalf("bad: %v", out.Len())
+	}
+}
+
+func TestTxn_LogErr(t *testing.T) {
+	txn := New[string]().Txn()
+	txn.SetLog(&errWriter{n: 16}, stringCodec{})
+	txn.Insert([]byte("foo"), "1")
+	txn.Insert([]byte("foo/bar/baz"), "2")
+	if err := txn.LogErr(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The batch is written on commit, and is too big for the writer. The
+	// transaction itself carries on.
+	r := txn.Commit()
+	if err := txn.LogErr(); err == nil {
+		t.Fatalf("expected error")
+	}
+	if r.Len() != 2 {
+		t.Fatalf("bad len: %d", r.Len())
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// closedCh is handed out by a watchCh that was notified before anything
+// watched it.
+var closedCh = make(chan struct{})
+
+func init() {
+	close(closedCh)
+}
+
+// watchCh is the mutation channel of a node or leaf. Most nodes are never
+// watched, so the channel is only made the first time something asks for
+// it, and notifying a watchCh that hasn't been made just marks it as
+// closed. Trees are read concurrently, so the channel is set with a compare
+// and swap, and is stored as an unsafe.Pointer to keep nodes the same size.
+type watchCh struct {
+	ch unsafe.Pointer
+}
+
+// load returns the channel, or nil if it hasn't been made yet.
+func (w *watchCh) load() chan struct{} {
+	p := atomic.LoadPointer(&w.ch)
+	return *(*chan struct{})(unsafe.Pointer(&p))
+}
+
+// get returns the channel, making it if needed.
+func (w *watchCh) get() chan struct{} {
+	if ch := w.load(); ch != nil {
+		return ch
+	}
+	ch := make(chan struct{})
+	if atomic.CompareAndSwapPointer(&w.ch, nil, *(*unsafe.Pointer)(unsafe.Pointer(&ch))) {
+		return ch
+	}
+	return w.load()
+}
+
+// notify closes the channel if it has been made, or otherwise marks it as
+// closed so that anything that watches it later is notified straight away.
+func (w *watchCh) notify() {
+	if atomic.CompareAndSwapPointer(&w.ch, nil, *(*unsafe.Pointer)(unsafe.Pointer(&closedCh))) {
+		return
+	}
+	if ch := w.load(); ch != closedCh {
+		close(ch)
+	}
+}
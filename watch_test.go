@@ -0,0 +1,188 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package iradix
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countWatchChs returns the number of nodes and leaves under root whose
+// watch channel has been made.
+func countWatchChs[T any](root *Node[T]) int {
+	made := 0
+	for iter := root.rawIterator(); iter.Front() != nil; iter.Next() {
+		n := iter.Front()
+		if n.mutateCh.load() != nil {
+			made++
+		}
+		if n.isLeaf() && n.leaf.mutateCh.load() != nil {
+			made++
+		}
+	}
+	return made
+}
+
+func TestWatch_Lazy(t *testing.T) {
+	r := New[int]()
+	txn := r.Txn()
+	txn.TrackMutate(true)
+	for i := 0; i < 1000; i++ {
+		txn.Insert([]byte(fmt.Sprintf("key/%03d", i)), i)
+	}
+	r = txn.Commit()
+	if made := countWatchChs(r.Root()); made != 0 {
+		t.Fatalf("bad: %d", made)
+	}
+
+	// Reads that don't watch don't make channels.
+	if _, ok := r.Get([]byte("key/500")); !ok {
+		t.Fatalf("bad")
+	}
+	iter := r.Root().Iterator()
+	iter.SeekPrefix([]byte("key/5"))
+	riter := r.Root().ReverseIterator()
+	riter.SeekPrefix([]byte("key/5"))
+	if made := countWatchChs(r.Root()); made != 0 {
+		t.Fatalf("bad: %d", made)
+	}
+
+	// Watching makes just the channel that is returned.
+	watch, _, ok := r.Root().GetWatch([]byte("key/500"))
+	if !ok || watch == nil {
+		t.Fatalf("bad")
+	}
+	if made := countWatchChs(r.Root()); made != 1 {
+		t.Fatalf("bad: %d", made)
+	}
+	watch2, _, _ := r.Root().GetWatch([]byte("key/500"))
+	if watch2 != watch {
+		t.Fatalf("bad: got a different channel")
+	}
+	iter = r.Root().Iterator()
+	if iter.SeekPrefixWatch([]byte("key/5")) == nil {
+		t.Fatalf("bad")
+	}
+	if made := countWatchChs(r.Root()); made != 2 {
+		t.Fatalf("bad: %d", made)
+	}
+}
+
+func TestWatch_AfterNotify(t *testing.T) {
+	for _, overflow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("overflow=%v", overflow), func(t *testing.T) {
+			r := New[int]()
+			keys := 10
+			if overflow {
+				keys = defaultModifiedCache + 10
+			}
+			for i := 0; i < keys; i++ {
+				r, _, _ = r.Insert([]byte(fmt.Sprintf("key/%05d", i)), i)
+			}
+
+			before, _, _ := r.Root().GetWatch([]byte("key/00001"))
+
+			txn := r.Txn()
+			txn.TrackMutate(true)
+			for i := 0; i < keys; i++ {
+				txn.Insert([]byte(fmt.Sprintf("key/%05d", i)), -i)
+			}
+			if overflow != txn.trackOverflow {
+				t.Fatalf("bad: %v", txn.trackOverflow)
+			}
+			txn.Commit()
+
+			// Channels made before and after the notification are both
+			// closed, as is the one for an unchanged prefix's parent.
+			after, _, _ := r.Root().GetWatch([]byte("key/00002"))
+			iter := r.Root().Iterator()
+			prefix := iter.SeekPrefixWatch([]byte("key/"))
+			for _, ch := range []<-chan struct{}{before, after, prefix} {
+				select {
+				case <-ch:
+				default:
+					t.Fatalf("bad: channel not closed")
+				}
+			}
+		})
+	}
+}
+
+func TestWatch_NotifyUnwatchedTwice(t *testing.T) {
+	var w watchCh
+	w.notify()
+	w.notify()
+	select {
+	case <-w.get():
+	default:
+		t.Fatalf("bad: channel not closed")
+	}
+}
+
+func TestWatch_Concurrent(t *testing.T) {
+	r := New[int]()
+	for i := 0; i < 100; i++ {
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("key/%03d", i)), i)
+	}
+
+	var wg sync.WaitGroup
+	watches := make(chan (<-chan struct{}), 800)
+	start := make(chan struct{})
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for i := 0; i < 100; i++ {
+				watch, _, _ := r.Root().GetWatch([]byte(fmt.Sprintf("key/%03d", i)))
+				watches <- watch
+			}
+		}()
+	}
+
+	txn := r.Txn()
+	txn.TrackMutate(true)
+	for i := 0; i < 100; i++ {
+		txn.Insert([]byte(fmt.Sprintf("key/%03d", i)), -i)
+	}
+	close(start)
+	txn.Commit()
+	wg.Wait()
+	close(watches)
+
+	timeout := time.After(time.Second)
+	for watch := range watches {
+		select {
+		case <-watch:
+		case <-timeout:
+			t.Fatalf("bad: channel not closed")
+		}
+	}
+}
+
+func BenchmarkTxnInsert_Unwatched(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		txn := New[int]().Txn()
+		for j := 0; j < 1000; j++ {
+			txn.Insert([]byte(fmt.Sprintf("key/%03d", j)), j)
+		}
+		txn.Commit()
+	}
+}
+
+func BenchmarkInsert_Unwatched(b *testing.B) {
+	r := New[int]()
+	for j := 0; j < 1000; j++ {
+		r, _, _ = r.Insert([]byte(fmt.Sprintf("key/%03d", j)), j)
+	}
+	key := []byte("key/500")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Insert(key, i)
+	}
+}